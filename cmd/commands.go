@@ -0,0 +1,234 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+//command описывает подкоманду: путь, признак изменения данных и обработчик
+type command struct {
+	path    []string
+	mutates bool
+	run     func(svc *wallet.Service, args []string) (interface{}, error)
+}
+
+var commands = []command{
+	{path: []string{"account", "register"}, mutates: true, run: accountRegister},
+	{path: []string{"account", "show"}, run: accountShow},
+	{path: []string{"account", "list"}, run: accountList},
+	{path: []string{"deposit"}, mutates: true, run: deposit},
+	{path: []string{"pay"}, mutates: true, run: pay},
+	{path: []string{"confirm"}, mutates: true, run: confirm},
+	{path: []string{"reject"}, mutates: true, run: reject},
+	{path: []string{"repeat"}, mutates: true, run: repeat},
+	{path: []string{"payment", "show"}, run: paymentShow},
+	{path: []string{"payments", "list"}, run: paymentList},
+	{path: []string{"favorites", "add"}, mutates: true, run: favoriteAdd},
+	{path: []string{"favorites", "pay"}, mutates: true, run: favoritePay},
+	{path: []string{"favorites", "list"}, run: favoriteList},
+	{path: []string{"sum"}, run: sum},
+}
+
+func lookupCommand(args []string) (command, bool) {
+	for _, cmd := range commands {
+		if len(args) < len(cmd.path) {
+			continue
+		}
+		matched := true
+		for i, word := range cmd.path {
+			if args[i] != word {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func accountRegister(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return svc.RegisterAccount(types.Phone(args[0]))
+}
+
+func accountShow(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return svc.FindAccountByID(accountID)
+}
+
+func accountList(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errUsage
+	}
+	return svc.Accounts(), nil
+}
+
+func deposit(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := svc.Deposit(accountID, amount); err != nil {
+		return nil, err
+	}
+	return svc.FindAccountByID(accountID)
+}
+
+func pay(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errUsage
+	}
+	accountID, err := parseAccountID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseAmount(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return svc.Pay(accountID, amount, types.PaymentCategory(args[2]))
+}
+
+func confirm(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	if err := svc.Confirm(args[0]); err != nil {
+		return nil, err
+	}
+	return svc.FindPaymentByID(args[0])
+}
+
+func reject(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	if err := svc.Reject(args[0]); err != nil {
+		return nil, err
+	}
+	return svc.FindPaymentByID(args[0])
+}
+
+func repeat(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return svc.Repeat(args[0])
+}
+
+func paymentShow(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return svc.FindPaymentByID(args[0])
+}
+
+func paymentList(svc *wallet.Service, args []string) (interface{}, error) {
+	accountID, all, err := optionalAccountID(args)
+	if err != nil {
+		return nil, err
+	}
+	payments := make([]*types.Payment, 0)
+	for _, payment := range svc.Payments() {
+		if all || payment.AccountID == accountID {
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+func favoriteAdd(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	return svc.FavoritePayment(args[0], args[1])
+}
+
+func favoritePay(svc *wallet.Service, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	return svc.PayFromFavorite(args[0])
+}
+
+func favoriteList(svc *wallet.Service, args []string) (interface{}, error) {
+	accountID, all, err := optionalAccountID(args)
+	if err != nil {
+		return nil, err
+	}
+	favorites := make([]*types.Favorite, 0)
+	for _, favorite := range svc.Favorites() {
+		if all || favorite.AccountID == accountID {
+			favorites = append(favorites, favorite)
+		}
+	}
+	return favorites, nil
+}
+
+//sumResult - результат команды sum
+type sumResult struct {
+	Sum types.Money `json:"sum"`
+}
+
+func sum(svc *wallet.Service, args []string) (interface{}, error) {
+	goroutines := 1
+	switch len(args) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return nil, errUsage
+		}
+		goroutines = n
+	default:
+		return nil, errUsage
+	}
+	return sumResult{Sum: svc.SumPayments(goroutines)}, nil
+}
+
+func parseAccountID(arg string) (int64, error) {
+	accountID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errUsage
+	}
+	return accountID, nil
+}
+
+func parseAmount(arg string) (types.Money, error) {
+	amount, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, errUsage
+	}
+	return types.Money(amount), nil
+}
+
+func optionalAccountID(args []string) (accountID int64, all bool, err error) {
+	switch len(args) {
+	case 0:
+		return 0, true, nil
+	case 1:
+		accountID, err = parseAccountID(args[0])
+		return accountID, false, err
+	default:
+		return 0, false, errUsage
+	}
+}
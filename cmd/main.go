@@ -1,60 +1,122 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	//"wallet/pkg/types"
-	//"strconv"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/RAZ-os/wallet/pkg/repl"
 	"github.com/RAZ-os/wallet/pkg/wallet"
-	//"github.com/RAZ-os/wallet/pkg/types"
-) 
+)
+
+const usage = `usage: wallet [-dir files] [-format dump|json|jsonl|binary] [-key-file keys.json] [-o table|json] [-v] <command> [args]
+
+commands:
+  account register <phone>
+  account show <account-id>
+  account list
+  deposit <account-id> <amount>
+  pay <account-id> <amount> <category>
+  confirm <payment-id>
+  reject <payment-id>
+  repeat <payment-id>
+  payment show <payment-id>
+  payments list [account-id]
+  favorites add <payment-id> <name>
+  favorites pay <favorite-id>
+  favorites list [account-id]
+  sum [goroutines]
+  shell
+`
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+//run разбирает флаги, загружает дамп, выполняет команду и сохраняет изменения
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("wallet", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	dir := flags.String("dir", "files", "dump directory")
+	formatName := flags.String("format", "dump", "dump files format: dump, json, jsonl or binary")
+	keyFile := flags.String("key-file", "", "JSON file with AES keys of encrypted dump files")
+	output := flags.String("o", "table", "output format: table or json")
+	verbose := flags.Bool("v", false, "log import and export details")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return errUsage
+	}
 
-func main(){
+	format, err := wallet.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return errUsage
+	}
 
-	/*payments := []types.Payment{
-		{ID: 1, Category: "auto", Amount: 2_000_000},
-		{ID: 2, Category: "food", Amount: 2_000_000},
-		{ID: 3, Category: "auto", Amount: 3_000_000},
-		{ID: 4, Category: "auto", Amount: 4_000_000},
-		{ID: 5, Category: "fun",  Amount: 5_000_000},
-	}*/
+	opts := []wallet.Option{wallet.WithFormat(format)}
+	if *keyFile != "" {
+		keys, err := wallet.LoadKeys(*keyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, wallet.WithEncryption(keys))
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	shell := flags.Arg(0) == "shell" && flags.NArg() == 1
+	cmd, ok := lookupCommand(flags.Args())
+	if !ok && !shell {
+		flags.Usage()
+		return errUsage
+	}
+
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
 
 	svc := &wallet.Service{}
-	account, err := svc.RegisterAccount("+992901000876")
-	payment, err := svc.Pay(1, 5_000_000, "fun")
-	payment, err = svc.Pay(1, 10_000_000, "auto")
-	//favorite, err := svc.FavoritePayment(payment.ID, "My Favorite Payment")
-	//sum := svc.SumPayments(1)
-	pro := svc.SumPaymentsWithProgress()
-	//path := "files/accounts.txt"
-	//dir := "files"
-	//err = svc.Export(dir)
-	//err = svc.Import(dir)
-	//err = svc.ExportToFile(path)
-	//err = svc.ImportFromFile(path)
-	
-	if err != nil{
-		fmt.Println(err)
-		return
-	}
-
-/*	if err_a != nil{
-		fmt.Println(err_a)
-		return
-	}
-
-	if err_p != nil {
-		fmt.Println(err_p)
-		return
-	}
-
-	if err_f != nil {
-		fmt.Println(err_f)
-		return
-	}
-	*/
-	fmt.Println(*account)
-	fmt.Println(payment)
-	//fmt.Println(favorite)
-	fmt.Println(pro)
-	fmt.Println(err)
-}
\ No newline at end of file
+	if err := svc.Import(*dir, opts...); err != nil {
+		return err
+	}
+
+	if shell {
+		return repl.New(svc, *dir, stdout, opts...).Run(stdin)
+	}
+
+	result, err := cmd.run(svc, flags.Args()[len(cmd.path):])
+	if err == errUsage {
+		flags.Usage()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cmd.mutates {
+		if err := svc.Export(*dir, opts...); err != nil {
+			return err
+		}
+	}
+
+	return render(stdout, *output, result)
+}
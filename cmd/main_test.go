@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+func runCommand(t *testing.T, dir string, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-dir", dir}, args...), strings.NewReader(""), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestRun_persistsBetweenCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//каждая команда загружает дамп и сохраняет изменения обратно
+	steps := [][]string{
+		{"account", "register", "+992901000876"},
+		{"deposit", "1", "10000"},
+		{"pay", "1", "4000", "auto"},
+	}
+	for _, step := range steps {
+		if _, err := runCommand(t, dir, step...); err != nil {
+			t.Errorf("run(%v): error = %v", step, err)
+			return
+		}
+	}
+
+	out, err := runCommand(t, dir, "-o", "json", "payments", "list", "1")
+	if err != nil {
+		t.Errorf("run(payments list): error = %v", err)
+		return
+	}
+
+	var payments []types.Payment
+	if err := json.Unmarshal([]byte(out), &payments); err != nil {
+		t.Errorf("run(payments list): invalid json %q, error = %v", out, err)
+		return
+	}
+	if len(payments) != 1 || payments[0].Amount != 4000 {
+		t.Errorf("run(payments list): wrong payments = %v", payments)
+		return
+	}
+
+	out, err = runCommand(t, dir, "account", "show", "1")
+	if err != nil {
+		t.Errorf("run(account show): error = %v", err)
+		return
+	}
+	if !strings.Contains(out, "6000") {
+		t.Errorf("run(account show): balance not updated, output = %q", out)
+		return
+	}
+
+	if _, err := runCommand(t, dir, "reject", payments[0].ID); err != nil {
+		t.Errorf("run(reject): error = %v", err)
+		return
+	}
+
+	out, err = runCommand(t, dir, "sum")
+	if err != nil || !strings.Contains(out, "4000") {
+		t.Errorf("run(sum): output = %q, error = %v", out, err)
+		return
+	}
+}
+
+func TestRun_keyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "keys.json")
+	keys := `{"current": "2020-11", "keys": {"2020-11": "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="}}`
+	if err := ioutil.WriteFile(keyFile, []byte(keys), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	//выгрузка шифруется, и без ключа её не прочитать
+	if _, err := runCommand(t, dir, "-key-file", keyFile, "account", "register", "+992901000876"); err != nil {
+		t.Fatalf("run(account register): error = %v", err)
+	}
+	if _, err := runCommand(t, dir, "account", "list"); !errors.Is(err, wallet.ErrKeyRequired) {
+		t.Errorf("run(account list) without key: want %v, got %v", wallet.ErrKeyRequired, err)
+	}
+	out, err := runCommand(t, dir, "-key-file", keyFile, "account", "show", "1")
+	if err != nil || !strings.Contains(out, "+992901000876") {
+		t.Errorf("run(account show): output = %q, error = %v", out, err)
+	}
+}
+
+func TestRun_usage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{{}, {"unknown"}, {"pay", "1"}, {"-o", "xml", "account", "list"}} {
+		if _, err := runCommand(t, dir, args...); err != errUsage {
+			t.Errorf("run(%v): must return errUsage, returned = %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/RAZ-os/wallet/pkg/output"
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//render печатает результат команды таблицей или JSON
+func render(w io.Writer, format string, result interface{}) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	table := output.NewTable(w)
+	switch v := result.(type) {
+	case *types.Account:
+		output.WriteAccounts(table, []*types.Account{v})
+	case []*types.Account:
+		output.WriteAccounts(table, v)
+	case *types.Payment:
+		output.WritePayments(table, []*types.Payment{v})
+	case []*types.Payment:
+		output.WritePayments(table, v)
+	case *types.Favorite:
+		output.WriteFavorites(table, []*types.Favorite{v})
+	case []*types.Favorite:
+		output.WriteFavorites(table, v)
+	case sumResult:
+		fmt.Fprintf(table, "SUM\n%d\n", v.Sum)
+	default:
+		return fmt.Errorf("can't render %T", result)
+	}
+	return table.Flush()
+}
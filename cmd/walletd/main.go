@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/server"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+	"github.com/RAZ-os/wallet/pkg/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "address to listen on")
+	dir := flag.String("dir", "", "dump directory to import on start and export on shutdown")
+	keyFile := flag.String("key-file", "", "JSON file with AES keys to decrypt the dump on start and encrypt it on shutdown")
+	auditPath := flag.String("audit", "", "hash-chained audit log file to append changes to")
+	webhooks := flag.String("webhooks", "", "webhook endpoints config file")
+	outboxDir := flag.String("outbox", "outbox", "directory of undelivered webhook events")
+	fraudRules := flag.String("fraud-rules", "", "fraud rules config file checked before each payment")
+	fees := flag.String("fees", "", "fee schedule config file applied to each payment")
+	rewards := flag.String("rewards", "", "reward programs config file, cashback is credited on payment confirm")
+	interest := flag.String("interest", "", "interest plans config file, accrued by POST /interest/accrue")
+	flag.Parse()
+
+	var dumpOpts []wallet.Option
+	if *keyFile != "" {
+		keys, err := wallet.LoadKeys(*keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dumpOpts = append(dumpOpts, wallet.WithEncryption(keys))
+	}
+
+	svc := &wallet.Service{}
+	if *auditPath != "" {
+		audit, closeAudit, err := openAudit(*auditPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer closeAudit()
+		svc.SetAuditLog(audit)
+	}
+	if *fraudRules != "" {
+		rules, err := wallet.LoadFraudRules(*fraudRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		svc.SetFraudRules(rules...)
+	}
+	if *fees != "" {
+		schedule, err := wallet.LoadFeeSchedule(*fees)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := svc.SetFeeSchedule(schedule...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *rewards != "" {
+		programs, err := wallet.LoadRewardPrograms(*rewards)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, program := range programs {
+			if err := svc.SetRewardProgram(program); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if *dir != "" {
+		if err := svc.Import(*dir, dumpOpts...); err != nil {
+			log.Fatal(err)
+		}
+	}
+	//планы счетов задаются после Import: счёт плана должен существовать
+	if *interest != "" {
+		plans, err := wallet.LoadInterestPlans(*interest)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, plan := range plans {
+			if err := svc.SetInterestPlan(plan); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksDone := make(chan struct{})
+	if *webhooks != "" {
+		dispatcher, err := openWebhooks(*webhooks, *outboxDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dispatcher.Subscribe(svc)
+		go func() {
+			defer close(webhooksDone)
+			dispatcher.Run(webhooksCtx)
+		}()
+	} else {
+		close(webhooksDone)
+	}
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: server.New(svc),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	log.Printf("walletd listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	stopWebhooks()
+	<-webhooksDone
+
+	if *dir != "" {
+		if err := svc.Export(*dir, dumpOpts...); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+//openAudit проверяет цепочку в файле path и открывает его на дописывание
+func openAudit(path string) (*wallet.AuditLog, func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audit, err := wallet.ResumeAuditLog(file, file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return audit, func() { file.Close() }, nil
+}
+
+//openWebhooks создаёт диспетчер вебхуков по конфигурации из файла path
+func openWebhooks(path string, outboxDir string) (*webhook.Dispatcher, error) {
+	config, err := webhook.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	outbox, err := webhook.OpenOutbox(outboxDir)
+	if err != nil {
+		return nil, err
+	}
+	return webhook.New(config, outbox)
+}
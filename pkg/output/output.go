@@ -0,0 +1,39 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//NewTable создаёт tabwriter, которым CLI и REPL выравнивают таблицы. Строки
+//пишутся через табуляцию, вывод появляется после Flush
+func NewTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
+
+//WriteAccounts пишет в таблицу w заголовок и строку на каждый счёт
+func WriteAccounts(w io.Writer, accounts []*types.Account) {
+	fmt.Fprintln(w, "ID\tPHONE\tBALANCE")
+	for _, account := range accounts {
+		fmt.Fprintf(w, "%d\t%s\t%d\n", account.ID, account.Phone, account.Balance)
+	}
+}
+
+//WritePayments пишет в таблицу w заголовок и строку на каждый платёж
+func WritePayments(w io.Writer, payments []*types.Payment) {
+	fmt.Fprintln(w, "ID\tACCOUNT\tAMOUNT\tCATEGORY\tSTATUS")
+	for _, payment := range payments {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", payment.ID, payment.AccountID, payment.Amount, payment.Category, payment.Status)
+	}
+}
+
+//WriteFavorites пишет в таблицу w заголовок и строку на каждое избранное
+func WriteFavorites(w io.Writer, favorites []*types.Favorite) {
+	fmt.Fprintln(w, "ID\tACCOUNT\tNAME\tAMOUNT\tCATEGORY")
+	for _, favorite := range favorites {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", favorite.ID, favorite.AccountID, favorite.Name, favorite.Amount, favorite.Category)
+	}
+}
@@ -0,0 +1,132 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+//Управляющие символы, которые обрабатывает lineEditor
+const (
+	keyTab       = '\t'
+	keyEnter     = '\n'
+	keyReturn    = '\r'
+	keyEOF       = 4 // Ctrl-D
+	keyBackspace = 8
+	keyDelete    = 127
+	keyEscape    = 27
+)
+
+//lineEditor читает строку посимвольно из терминала без построчного ввода и эха:
+//сам отображает ввод, стирает символы, дополняет слово по Tab и листает
+//историю стрелками вверх и вниз
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete func(line string) []string
+	history  func() []string
+}
+
+//readLine печатает prompt и возвращает введённую строку. io.EOF - Ctrl-D на
+//пустой строке или конец ввода
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	var line []rune
+	history := e.history()
+	position := len(history)
+
+	for {
+		key, _, err := e.in.ReadRune()
+		if err == io.EOF && len(line) > 0 {
+			fmt.Fprintln(e.out)
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyReturn:
+			fmt.Fprintln(e.out)
+			return string(line), nil
+		case keyEOF:
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(e.out, "\b \b")
+			}
+		case keyTab:
+			line = e.completeLine(prompt, line)
+		case keyEscape:
+			//стрелки приходят последовательностями ESC [ A и ESC [ B
+			if next, _ := e.in.ReadByte(); next != '[' {
+				continue
+			}
+			switch arrow, _ := e.in.ReadByte(); {
+			case arrow == 'A' && position > 0:
+				position--
+			case arrow == 'B' && position < len(history):
+				position++
+			default:
+				continue
+			}
+			line = nil
+			if position < len(history) {
+				line = []rune(history[position])
+			}
+			e.redraw(prompt, line)
+		default:
+			if unicode.IsPrint(key) {
+				line = append(line, key)
+				fmt.Fprint(e.out, string(key))
+			}
+		}
+	}
+}
+
+//completeLine дополняет последнее слово line. Единственный вариант подставляется
+//целиком, из нескольких - их общее начало, а если дополнять нечего, варианты печатаются
+func (e *lineEditor) completeLine(prompt string, line []rune) []rune {
+	text := string(line)
+	candidates := e.complete(text)
+	if len(candidates) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return line
+	}
+
+	word := text[strings.LastIndex(text, " ")+1:]
+	completion := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		completion += " "
+	}
+	if len(completion) > len(word) {
+		added := completion[len(word):]
+		fmt.Fprint(e.out, added)
+		return append(line, []rune(added)...)
+	}
+
+	fmt.Fprintln(e.out)
+	fmt.Fprintln(e.out, strings.Join(candidates, "  "))
+	fmt.Fprint(e.out, prompt, text)
+	return line
+}
+
+//redraw заменяет текущую строку терминала на prompt и line
+func (e *lineEditor) redraw(prompt string, line []rune) {
+	fmt.Fprint(e.out, "\r\033[K", prompt, string(line))
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,509 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RAZ-os/wallet/pkg/output"
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+//Prompt печатается перед каждой командой
+const Prompt = "wallet> "
+
+var errUsage = errors.New("invalid arguments, see help")
+
+//argKind определяет, чем дополняется аргумент команды
+type argKind int
+
+const (
+	argNone argKind = iota
+	argAccount
+	argPayment
+	argFavorite
+)
+
+type command struct {
+	name    string
+	args    []argKind
+	help    string
+	mutates bool
+	run     func(r *REPL, args []string) error
+}
+
+//REPL - интерактивная оболочка над wallet.Service, загруженным из каталога дампа
+type REPL struct {
+	svc      *wallet.Service
+	dir      string
+	opts     []wallet.Option
+	out      io.Writer
+	history  []string
+	dirty    bool
+	warned   bool
+	commands []command
+}
+
+//New создаёт оболочку. Команда commit выгружает изменения через Export в dir с опциями opts
+func New(svc *wallet.Service, dir string, out io.Writer, opts ...wallet.Option) *REPL {
+	r := &REPL{svc: svc, dir: dir, out: out, opts: opts}
+	r.commands = []command{
+		{name: "help", help: "show this help", run: (*REPL).help},
+		{name: "accounts", help: "list accounts", run: (*REPL).accounts},
+		{name: "account", args: []argKind{argAccount}, help: "account <id> - show account", run: (*REPL).account},
+		{name: "payments", args: []argKind{argAccount}, help: "payments [account-id] - list payments", run: (*REPL).payments},
+		{name: "payment", args: []argKind{argPayment}, help: "payment <id> - show payment", run: (*REPL).payment},
+		{name: "favorites", args: []argKind{argAccount}, help: "favorites [account-id] - list favorites", run: (*REPL).favorites},
+		{name: "deposit", args: []argKind{argAccount, argNone}, help: "deposit <account-id> <amount>", mutates: true, run: (*REPL).deposit},
+		{name: "pay", args: []argKind{argAccount, argNone, argNone}, help: "pay <account-id> <amount> <category>", mutates: true, run: (*REPL).pay},
+		{name: "reject", args: []argKind{argPayment}, help: "reject <payment-id>", mutates: true, run: (*REPL).reject},
+		{name: "confirm", args: []argKind{argPayment}, help: "confirm <payment-id>", mutates: true, run: (*REPL).confirm},
+		{name: "repeat", args: []argKind{argPayment}, help: "repeat <payment-id>", mutates: true, run: (*REPL).repeat},
+		{name: "favorite", args: []argKind{argPayment, argNone}, help: "favorite <payment-id> <name>", mutates: true, run: (*REPL).favorite},
+		{name: "payfav", args: []argKind{argFavorite}, help: "payfav <favorite-id> - pay from favorite", mutates: true, run: (*REPL).payFavorite},
+		{name: "sum", help: "sum [account-id] - sum of payments", args: []argKind{argAccount}, run: (*REPL).sum},
+		{name: "history", help: "show command history, !n or !! repeats a command", run: (*REPL).showHistory},
+		{name: "commit", help: "export changes back to the dump directory", run: (*REPL).commit},
+		{name: "quit", help: "leave the shell"},
+	}
+	return r
+}
+
+//Run читает команды из in до quit или конца ввода. Если in - терминал (Linux),
+//строка редактируется в нём: Tab дополняет команду или ID, стрелки листают
+//историю. Из файлов и каналов строки читаются целиком, и строка, оканчивающаяся
+//табуляцией, не выполняется, а печатает варианты дополнения
+func (r *REPL) Run(in io.Reader) error {
+	readLine := r.scanLines(in)
+	if file, ok := in.(*os.File); ok {
+		if restore, err := makeRaw(file.Fd()); err == nil {
+			defer restore()
+			editor := &lineEditor{in: bufio.NewReader(file), out: r.out, complete: r.Complete, history: r.History}
+			readLine = editor.readLine
+		}
+	}
+
+	for {
+		line, err := readLine(Prompt)
+		if err == io.EOF {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, err = r.expandHistory(strings.TrimSpace(line))
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		r.history = append(r.history, line)
+
+		if r.Exec(line) {
+			return nil
+		}
+	}
+}
+
+//scanLines возвращает чтение строк in целиком. Строки, оканчивающиеся табуляцией,
+//не возвращаются: вместо них печатаются варианты дополнения
+func (r *REPL) scanLines(in io.Reader) func(prompt string) (string, error) {
+	scanner := bufio.NewScanner(in)
+	return func(prompt string) (string, error) {
+		for {
+			fmt.Fprint(r.out, prompt)
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+
+			line := scanner.Text()
+			if !strings.HasSuffix(line, "\t") {
+				return line, nil
+			}
+			r.printCompletions(strings.TrimRight(line, "\t"))
+		}
+	}
+}
+
+//Exec выполняет одну команду и сообщает, нужно ли завершить работу
+func (r *REPL) Exec(line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+
+	if fields[0] == "quit" || fields[0] == "exit" {
+		if r.dirty && !r.warned {
+			r.warned = true
+			fmt.Fprintln(r.out, "there are uncommitted changes, run commit or quit again to discard them")
+			return false
+		}
+		return true
+	}
+
+	cmd, ok := r.lookup(fields[0])
+	if !ok {
+		fmt.Fprintf(r.out, "unknown command %q, see help\n", fields[0])
+		return false
+	}
+
+	if err := cmd.run(r, fields[1:]); err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+		return false
+	}
+	if cmd.mutates {
+		r.dirty = true
+		r.warned = false
+	}
+	return false
+}
+
+//Complete возвращает варианты дополнения последнего слова строки
+func (r *REPL) Complete(line string) []string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.HasSuffix(line, " ") && len(fields) == 1 {
+		prefix := ""
+		if len(fields) == 1 {
+			prefix = fields[0]
+		}
+		names := make([]string, 0, len(r.commands))
+		for _, cmd := range r.commands {
+			names = append(names, cmd.name)
+		}
+		return filterPrefix(names, prefix)
+	}
+
+	cmd, ok := r.lookup(fields[0])
+	if !ok {
+		return nil
+	}
+
+	position := len(fields) - 1
+	prefix := fields[len(fields)-1]
+	if strings.HasSuffix(line, " ") {
+		position = len(fields)
+		prefix = ""
+	}
+	if position-1 >= len(cmd.args) {
+		return nil
+	}
+
+	var candidates []string
+	switch cmd.args[position-1] {
+	case argAccount:
+		for _, account := range r.svc.Accounts() {
+			candidates = append(candidates, strconv.FormatInt(account.ID, 10))
+		}
+	case argPayment:
+		for _, payment := range r.svc.Payments() {
+			candidates = append(candidates, payment.ID)
+		}
+	case argFavorite:
+		for _, favorite := range r.svc.Favorites() {
+			candidates = append(candidates, favorite.ID)
+		}
+	}
+	return filterPrefix(candidates, prefix)
+}
+
+//History возвращает выполненные команды
+func (r *REPL) History() []string {
+	return append([]string(nil), r.history...)
+}
+
+func (r *REPL) lookup(name string) (command, bool) {
+	for _, cmd := range r.commands {
+		if cmd.name == name && cmd.run != nil {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func (r *REPL) printCompletions(line string) {
+	candidates := r.Complete(line)
+	switch len(candidates) {
+	case 0:
+		fmt.Fprintln(r.out, "no completions")
+	case 1:
+		fields := strings.Fields(line)
+		if !strings.HasSuffix(line, " ") && len(fields) > 0 {
+			fields = fields[:len(fields)-1]
+		}
+		fmt.Fprintln(r.out, strings.Join(append(fields, candidates[0]), " "))
+	default:
+		fmt.Fprintln(r.out, strings.Join(candidates, "  "))
+	}
+}
+
+//expandHistory подставляет команду из истории вместо !! и !n
+func (r *REPL) expandHistory(line string) (string, error) {
+	if !strings.HasPrefix(line, "!") {
+		return line, nil
+	}
+	if len(r.history) == 0 {
+		return "", errors.New("history is empty")
+	}
+	if line == "!!" {
+		return r.history[len(r.history)-1], nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(r.history) {
+		return "", fmt.Errorf("no such history entry %q", line)
+	}
+	return r.history[n-1], nil
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var matched []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matched = append(matched, candidate)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func (r *REPL) help(args []string) error {
+	table := output.NewTable(r.out)
+	for _, cmd := range r.commands {
+		fmt.Fprintf(table, "%s\t%s\n", cmd.name, cmd.help)
+	}
+	return table.Flush()
+}
+
+func (r *REPL) accounts(args []string) error {
+	r.printAccounts(r.svc.Accounts())
+	return nil
+}
+
+func (r *REPL) account(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	accountID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	account, err := r.svc.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+	r.printAccounts([]*types.Account{account})
+	return nil
+}
+
+func (r *REPL) payments(args []string) error {
+	accountID, all, err := optionalAccount(args)
+	if err != nil {
+		return err
+	}
+	var payments []*types.Payment
+	for _, payment := range r.svc.Payments() {
+		if all || payment.AccountID == accountID {
+			payments = append(payments, payment)
+		}
+	}
+	r.printPayments(payments)
+	return nil
+}
+
+func (r *REPL) payment(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	payment, err := r.svc.FindPaymentByID(args[0])
+	if err != nil {
+		return err
+	}
+	r.printPayments([]*types.Payment{payment})
+	return nil
+}
+
+func (r *REPL) favorites(args []string) error {
+	accountID, all, err := optionalAccount(args)
+	if err != nil {
+		return err
+	}
+	var favorites []*types.Favorite
+	for _, favorite := range r.svc.Favorites() {
+		if all || favorite.AccountID == accountID {
+			favorites = append(favorites, favorite)
+		}
+	}
+	table := output.NewTable(r.out)
+	output.WriteFavorites(table, favorites)
+	return table.Flush()
+}
+
+func (r *REPL) deposit(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	accountID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	if err := r.svc.Deposit(accountID, types.Money(amount)); err != nil {
+		return err
+	}
+	return r.account(args[:1])
+}
+
+func (r *REPL) pay(args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	accountID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	payment, err := r.svc.Pay(accountID, types.Money(amount), types.PaymentCategory(args[2]))
+	if err != nil {
+		return err
+	}
+	r.printPayments([]*types.Payment{payment})
+	return nil
+}
+
+func (r *REPL) reject(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := r.svc.Reject(args[0]); err != nil {
+		return err
+	}
+	return r.payment(args)
+}
+
+func (r *REPL) confirm(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := r.svc.Confirm(args[0]); err != nil {
+		return err
+	}
+	return r.payment(args)
+}
+
+func (r *REPL) repeat(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	payment, err := r.svc.Repeat(args[0])
+	if err != nil {
+		return err
+	}
+	r.printPayments([]*types.Payment{payment})
+	return nil
+}
+
+func (r *REPL) favorite(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	favorite, err := r.svc.FavoritePayment(args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "favorite %s created\n", favorite.ID)
+	return nil
+}
+
+func (r *REPL) payFavorite(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	payment, err := r.svc.PayFromFavorite(args[0])
+	if err != nil {
+		return err
+	}
+	r.printPayments([]*types.Payment{payment})
+	return nil
+}
+
+func (r *REPL) sum(args []string) error {
+	accountID, all, err := optionalAccount(args)
+	if err != nil {
+		return err
+	}
+	if all {
+		fmt.Fprintln(r.out, r.svc.SumPayments(1))
+		return nil
+	}
+
+	total := types.Money(0)
+	for _, payment := range r.svc.Payments() {
+		if payment.AccountID == accountID {
+			total += payment.Amount
+		}
+	}
+	fmt.Fprintln(r.out, total)
+	return nil
+}
+
+func (r *REPL) showHistory(args []string) error {
+	for i, line := range r.history {
+		fmt.Fprintf(r.out, "%4d  %s\n", i+1, line)
+	}
+	return nil
+}
+
+func (r *REPL) commit(args []string) error {
+	if err := r.svc.Export(r.dir, r.opts...); err != nil {
+		return err
+	}
+	r.dirty = false
+	fmt.Fprintf(r.out, "exported to %s\n", r.dir)
+	return nil
+}
+
+func (r *REPL) printAccounts(accounts []*types.Account) {
+	table := output.NewTable(r.out)
+	output.WriteAccounts(table, accounts)
+	table.Flush()
+}
+
+func (r *REPL) printPayments(payments []*types.Payment) {
+	table := output.NewTable(r.out)
+	output.WritePayments(table, payments)
+	table.Flush()
+}
+
+func optionalAccount(args []string) (accountID int64, all bool, err error) {
+	switch len(args) {
+	case 0:
+		return 0, true, nil
+	case 1:
+		accountID, err = strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return 0, false, errUsage
+		}
+		return accountID, false, nil
+	default:
+		return 0, false, errUsage
+	}
+}
@@ -0,0 +1,145 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+func newTestREPL(t *testing.T) (*REPL, *wallet.Service, *bytes.Buffer) {
+	t.Helper()
+
+	svc := &wallet.Service{}
+	account, err := svc.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 10_000_00); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	return New(svc, "", out), svc, out
+}
+
+func TestREPL_Complete(t *testing.T) {
+	r, svc, _ := newTestREPL(t)
+
+	payment, err := svc.Pay(1, 1_000_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"pa", []string{"pay", "payfav", "payment", "payments"}},
+		{"rej", []string{"reject"}},
+		{"reject ", []string{payment.ID}},
+		{"conf", []string{"confirm"}},
+		{"confirm ", []string{payment.ID}},
+		{"reject " + payment.ID[:4], []string{payment.ID}},
+		{"deposit ", []string{"1"}},
+		{"deposit 1 ", nil},
+		{"unknown ", nil},
+	}
+
+	for _, tt := range tests {
+		got := r.Complete(tt.line)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q): want %v got %v", tt.line, tt.want, got)
+		}
+	}
+}
+
+func TestLineEditor_readLine(t *testing.T) {
+	r, svc, out := newTestREPL(t)
+	payment, err := svc.Pay(1, 1_000_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.history = []string{"accounts", "payments 1"}
+
+	tests := []struct {
+		input string
+		want  string
+		shown string // напечатанные варианты
+	}{
+		{"rej\t" + payment.ID[:4] + "\t\n", "reject " + payment.ID + " ", ""},
+		{"pa\t\n", "pay", ""}, // общее начало pay, payfav, payment, payments
+		{"pay\t\n", "pay", "pay  payfav  payment  payments"},
+		{"acx\bcounts\x7f\x7fts\n", "accounts", ""},
+		{"\x1b[A\x1b[A\x1b[B\n", "payments 1", ""}, // стрелки по истории
+		{"sum", "sum", ""},                         // конец ввода без перевода строки
+	}
+	for _, tt := range tests {
+		out.Reset()
+		editor := &lineEditor{in: bufio.NewReader(strings.NewReader(tt.input)), out: out, complete: r.Complete, history: r.History}
+		got, err := editor.readLine(Prompt)
+		if err != nil || got != tt.want {
+			t.Errorf("readLine(%q): want %q got %q, error = %v", tt.input, tt.want, got, err)
+		}
+		if !strings.Contains(out.String(), tt.shown) {
+			t.Errorf("readLine(%q): want %q shown, output = %q", tt.input, tt.shown, out.String())
+		}
+	}
+
+	editor := &lineEditor{in: bufio.NewReader(strings.NewReader("\x04")), out: out, complete: r.Complete, history: r.History}
+	if _, err := editor.readLine(Prompt); err != io.EOF {
+		t.Errorf("readLine(Ctrl-D): want io.EOF, got %v", err)
+	}
+}
+
+func TestREPL_Run_historyAndCommit(t *testing.T) {
+	r, svc, out := newTestREPL(t)
+
+	dir, err := ioutil.TempDir("", "wallet-repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r.dir = dir
+
+	input := strings.Join([]string{
+		"pay 1 1000 auto",
+		"!!",
+		"history",
+		"quit",
+		"commit",
+		"quit",
+	}, "\n")
+
+	if err := r.Run(strings.NewReader(input)); err != nil {
+		t.Errorf("Run(): error = %v", err)
+		return
+	}
+
+	if len(svc.Payments()) != 2 {
+		t.Errorf("Run(): !! must repeat the payment, payments = %v", svc.Payments())
+		return
+	}
+	if !strings.Contains(out.String(), "uncommitted changes") {
+		t.Errorf("Run(): quit with uncommitted changes must warn, output = %q", out.String())
+		return
+	}
+
+	restored := &wallet.Service{}
+	if err := restored.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	account, err := restored.FindAccountByID(1)
+	if err != nil || account.Balance != types.Money(10_000_00-2_000) {
+		t.Errorf("Run(): commit didn't export changes, account = %v, error = %v", account, err)
+		return
+	}
+}
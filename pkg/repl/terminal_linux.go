@@ -0,0 +1,33 @@
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+//makeRaw выключает в терминале fd построчный ввод и эхо, чтобы Tab и стрелки
+//обрабатывал lineEditor. Сигналы и вывод не меняются. Для fd, который не
+//терминал, возвращает ошибку
+func makeRaw(fd uintptr) (restore func(), err error) {
+	var old syscall.Termios
+	if err := termios(fd, syscall.TCGETS, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termios(fd, syscall.TCSETS, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termios(fd, syscall.TCSETS, &old) }, nil
+}
+
+func termios(fd uintptr, request uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(state)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
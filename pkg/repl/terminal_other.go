@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package repl
+
+import "errors"
+
+//makeRaw не поддерживается: Run читает строки целиком, см. REPL.Run
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("terminal line editing is not supported on this platform")
+}
@@ -0,0 +1,567 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+// Заголовки, из которых берутся инициатор запроса и идентификатор трассировки
+const (
+	HeaderActor   = "X-Actor"
+	HeaderTraceID = "X-Request-ID"
+)
+
+// Server отдаёт методы wallet.Service как JSON API
+type Server struct {
+	mu  sync.Mutex
+	svc *wallet.Service
+	mux *http.ServeMux
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type registerRequest struct {
+	Phone types.Phone `json:"phone"`
+}
+
+type depositRequest struct {
+	Amount types.Money `json:"amount"`
+}
+
+type payRequest struct {
+	AccountID int64                 `json:"accountId"`
+	Amount    types.Money           `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+}
+
+type limitRequest struct {
+	Category types.PaymentCategory `json:"category"`
+	Period   wallet.LimitPeriod    `json:"period"`
+	Rolling  bool                  `json:"rolling"`
+	Amount   types.Money           `json:"amount"`
+}
+
+type budgetRequest struct {
+	Category types.PaymentCategory `json:"category"`
+	Amount   types.Money           `json:"amount"`
+}
+
+type favoriteRequest struct {
+	Name string `json:"name"`
+}
+
+// New создаёт сервер поверх svc. Запросы к сервису выполняются последовательно
+func New(svc *wallet.Service) *Server {
+	s := &Server{svc: svc, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/accounts", s.handleAccounts)
+	s.mux.HandleFunc("/accounts/", s.handleAccount)
+	s.mux.HandleFunc("/payments", s.handlePayments)
+	s.mux.HandleFunc("/payments/", s.handlePayment)
+	s.mux.HandleFunc("/favorites/", s.handleFavorite)
+	s.mux.HandleFunc("/fees", s.handleFees)
+	s.mux.HandleFunc("/fraud/attempts", s.handleFraudAttempts)
+	s.mux.HandleFunc("/interest/accrue", s.handleAccrueInterest)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if actor := r.Header.Get(HeaderActor); actor != "" {
+		ctx = wallet.WithActor(ctx, actor)
+	}
+	if traceID := r.Header.Get(HeaderTraceID); traceID != "" {
+		ctx = wallet.WithTraceID(ctx, traceID)
+		w.Header().Set(HeaderTraceID, traceID)
+	}
+
+	s.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// POST /accounts
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req registerRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	account, err := s.svc.RegisterAccountContext(r.Context(), req.Phone)
+	if err == nil {
+		copied := *account
+		account = &copied
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// GET /accounts/{id}, POST /accounts/{id}/deposit, GET|POST /accounts/{id}/limits,
+// GET /accounts/{id}/budgets?month=YYYY-MM, POST /accounts/{id}/budgets,
+// GET /accounts/{id}/statement?month=YYYY-MM&format=json|text|html
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	id, action := splitPath(r.URL.Path, "/accounts/")
+	accountID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid account id"})
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.mu.Lock()
+		account, err := s.svc.FindAccountByID(accountID)
+		if err == nil {
+			copied := *account
+			account = &copied
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, account)
+	case "deposit":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var req depositRequest
+		if !decode(w, r, &req) {
+			return
+		}
+
+		s.mu.Lock()
+		err := s.svc.DepositContext(r.Context(), accountID, req.Amount)
+		var account types.Account
+		if err == nil {
+			found, _ := s.svc.FindAccountByID(accountID)
+			account = *found
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, account)
+	case "limits":
+		//POST задаёт лимит, заменяя лимит с той же категорией и периодом,
+		//и отвечает, как GET, расходом по всем лимитам счёта
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodGet+", "+http.MethodPost)
+			return
+		}
+		var req limitRequest
+		if r.Method == http.MethodPost && !decode(w, r, &req) {
+			return
+		}
+		s.mu.Lock()
+		if r.Method == http.MethodPost {
+			err = s.svc.SetLimit(wallet.Limit{
+				AccountID: accountID,
+				Category:  req.Category,
+				Period:    req.Period,
+				Rolling:   req.Rolling,
+				Amount:    req.Amount,
+			})
+		}
+		var usages []wallet.LimitUsage
+		if err == nil {
+			usages, err = s.svc.LimitUsage(accountID)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if usages == nil {
+			usages = []wallet.LimitUsage{}
+		}
+		writeJSON(w, http.StatusOK, usages)
+	case "budgets":
+		//POST задаёт бюджет на категорию и отвечает, как GET, отчётом за месяц.
+		//Без month - текущий месяц по часам сервиса, как у платежей
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodGet+", "+http.MethodPost)
+			return
+		}
+		var month time.Time
+		if text := r.URL.Query().Get("month"); text != "" {
+			if month, err = time.Parse("2006-01", text); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "month must be YYYY-MM"})
+				return
+			}
+		}
+		var req budgetRequest
+		if r.Method == http.MethodPost && !decode(w, r, &req) {
+			return
+		}
+		s.mu.Lock()
+		if r.Method == http.MethodPost {
+			err = s.svc.SetBudget(wallet.Budget{AccountID: accountID, Category: req.Category, Amount: req.Amount})
+		}
+		var report []wallet.BudgetStatus
+		if err == nil {
+			report, err = s.svc.BudgetReport(accountID, month)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if report == nil {
+			report = []wallet.BudgetStatus{}
+		}
+		writeJSON(w, http.StatusOK, report)
+	case "statement":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		month := time.Now()
+		if text := r.URL.Query().Get("month"); text != "" {
+			if month, err = time.Parse("2006-01", text); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "month must be YYYY-MM"})
+				return
+			}
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "text" && format != "html" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "format must be json, text or html"})
+			return
+		}
+		s.mu.Lock()
+		statement, err := s.svc.MonthStatement(accountID, month)
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		switch format {
+		case "text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			err = statement.WriteText(w, wallet.LocaleEN)
+		case "html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = statement.WriteHTML(w, wallet.LocaleEN)
+		default:
+			writeJSON(w, http.StatusOK, statement)
+		}
+		if err != nil {
+			log.Print(err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// POST /payments
+func (s *Server) handlePayments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req payRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.respondPayment(w, r, http.StatusCreated, func(ctx context.Context) (*types.Payment, error) {
+		return s.svc.PayContext(ctx, req.AccountID, req.Amount, req.Category)
+	})
+}
+
+// GET /payments/{id}, POST /payments/{id}/confirm|reject|repeat|favorite
+func (s *Server) handlePayment(w http.ResponseWriter, r *http.Request) {
+	id, action := splitPath(r.URL.Path, "/payments/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.respondPayment(w, r, http.StatusOK, func(ctx context.Context) (*types.Payment, error) {
+			return s.svc.FindPaymentByID(id)
+		})
+	case "confirm":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.respondPayment(w, r, http.StatusOK, func(ctx context.Context) (*types.Payment, error) {
+			if err := s.svc.ConfirmContext(ctx, id); err != nil {
+				return nil, err
+			}
+			return s.svc.FindPaymentByID(id)
+		})
+	case "reject":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.respondPayment(w, r, http.StatusOK, func(ctx context.Context) (*types.Payment, error) {
+			if err := s.svc.RejectContext(ctx, id); err != nil {
+				return nil, err
+			}
+			return s.svc.FindPaymentByID(id)
+		})
+	case "repeat":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.respondPayment(w, r, http.StatusCreated, func(ctx context.Context) (*types.Payment, error) {
+			return s.svc.RepeatContext(ctx, id)
+		})
+	case "favorite":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var req favoriteRequest
+		if !decode(w, r, &req) {
+			return
+		}
+
+		s.mu.Lock()
+		favorite, err := s.svc.FavoritePaymentContext(r.Context(), id, req.Name)
+		if err == nil {
+			copied := *favorite
+			favorite = &copied
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, favorite)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GET /favorites/{id}, POST /favorites/{id}/pay
+func (s *Server) handleFavorite(w http.ResponseWriter, r *http.Request) {
+	id, action := splitPath(r.URL.Path, "/favorites/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.mu.Lock()
+		favorite, err := s.svc.FindFavoritePaymentByID(id)
+		if err == nil {
+			copied := *favorite
+			favorite = &copied
+		}
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, favorite)
+	case "pay":
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.respondPayment(w, r, http.StatusCreated, func(ctx context.Context) (*types.Payment, error) {
+			return s.svc.PayFromFavoriteContext(ctx, id)
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GET /fees?month=YYYY-MM - доход от комиссий за месяц, без month - за всё время
+func (s *Server) handleFees(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var from, to time.Time
+	if text := r.URL.Query().Get("month"); text != "" {
+		month, err := time.Parse("2006-01", text)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "month must be YYYY-MM"})
+			return
+		}
+		from, to = month, month.AddDate(0, 1, 0)
+	}
+	s.mu.Lock()
+	revenue := s.svc.FeeRevenue(from, to)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, revenue)
+}
+
+// GET /fraud/attempts?account=ID - платежи, отклонённые или отправленные на
+// проверку антифрод-правилами, без account - всех счетов
+func (s *Server) handleFraudAttempts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var accountID int64
+	if text := r.URL.Query().Get("account"); text != "" {
+		id, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid account id"})
+			return
+		}
+		accountID = id
+	}
+	s.mu.Lock()
+	attempts := s.svc.FraudAttempts()
+	s.mu.Unlock()
+
+	filtered := make([]wallet.FraudAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		if accountID == 0 || attempt.AccountID == accountID {
+			filtered = append(filtered, attempt)
+		}
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+// POST /interest/accrue - начисление процентов, вызывается планировщиком ежедневно
+func (s *Server) handleAccrueInterest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	s.mu.Lock()
+	entries, err := s.svc.AccrueInterestContext(r.Context())
+	copied := make([]types.Entry, 0, len(entries))
+	for _, entry := range entries {
+		copied = append(copied, *entry)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, copied)
+}
+
+// respondPayment выполняет call под блокировкой и отдаёт копию платежа
+func (s *Server) respondPayment(w http.ResponseWriter, r *http.Request, status int, call func(ctx context.Context) (*types.Payment, error)) {
+	s.mu.Lock()
+	payment, err := call(r.Context())
+	if err == nil {
+		copied := *payment
+		payment = &copied
+	}
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, status, payment)
+}
+
+// splitPath разбирает "/prefix/{id}/{action}"
+func splitPath(path string, prefix string) (id string, action string) {
+	rest := strings.Trim(strings.TrimPrefix(path, prefix), "/")
+	parts := strings.SplitN(rest, "/", 2)
+	id = parts[0]
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	return id, action
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// statusCode сопоставляет ошибки сервиса с кодами HTTP
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, wallet.ErrAccountNotFound),
+		errors.Is(err, wallet.ErrPaymentNotFound),
+		errors.Is(err, wallet.ErrFavoriteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, wallet.ErrPhoneRegistered),
+		errors.Is(err, wallet.ErrPaymentNotInProgress):
+		return http.StatusConflict
+	case errors.Is(err, wallet.ErrAmountMustBePositive),
+		errors.Is(err, wallet.ErrInvalidLimit):
+		return http.StatusBadRequest
+	case errors.Is(err, wallet.ErrPaymentDenied):
+		return http.StatusForbidden
+	case errors.Is(err, wallet.ErrLimitExceeded):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := statusCode(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		log.Print(err)
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+func doJSON(t *testing.T, method string, url string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: can't decode response, error = %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServer_paymentFlow(t *testing.T) {
+	ts := httptest.NewServer(New(&wallet.Service{}))
+	defer ts.Close()
+
+	//регистрируем и пополняем
+	var account types.Account
+	if code := doJSON(t, http.MethodPost, ts.URL+"/accounts", map[string]string{"phone": "+992901000876"}, &account); code != http.StatusCreated {
+		t.Errorf("POST /accounts: want status %v got %v", http.StatusCreated, code)
+		return
+	}
+	accountURL := ts.URL + "/accounts/" + strconv.FormatInt(account.ID, 10)
+	if code := doJSON(t, http.MethodPost, accountURL+"/deposit", map[string]int64{"amount": 10_000_00}, &account); code != http.StatusOK {
+		t.Errorf("POST /accounts/{id}/deposit: want status %v got %v", http.StatusOK, code)
+		return
+	}
+
+	//платим и добавляем в избранное
+	var payment types.Payment
+	code := doJSON(t, http.MethodPost, ts.URL+"/payments", map[string]interface{}{"accountId": account.ID, "amount": 4_000_00, "category": "auto"}, &payment)
+	if code != http.StatusCreated || payment.Status != types.PaymentStatusInProgress {
+		t.Errorf("POST /payments: status %v, payment = %v", code, payment)
+		return
+	}
+
+	var favorite types.Favorite
+	if code := doJSON(t, http.MethodPost, ts.URL+"/payments/"+payment.ID+"/favorite", map[string]string{"name": "Car"}, &favorite); code != http.StatusCreated {
+		t.Errorf("POST /payments/{id}/favorite: want status %v got %v", http.StatusCreated, code)
+		return
+	}
+
+	var fromFavorite types.Payment
+	if code := doJSON(t, http.MethodPost, ts.URL+"/favorites/"+favorite.ID+"/pay", nil, &fromFavorite); code != http.StatusCreated {
+		t.Errorf("POST /favorites/{id}/pay: want status %v got %v", http.StatusCreated, code)
+		return
+	}
+
+	//отменяем и повторяем
+	var rejected types.Payment
+	if code := doJSON(t, http.MethodPost, ts.URL+"/payments/"+payment.ID+"/reject", nil, &rejected); code != http.StatusOK || rejected.Status != types.PaymentStatusFail {
+		t.Errorf("POST /payments/{id}/reject: status %v, payment = %v", code, rejected)
+		return
+	}
+
+	var repeated types.Payment
+	if code := doJSON(t, http.MethodPost, ts.URL+"/payments/"+payment.ID+"/repeat", nil, &repeated); code != http.StatusCreated || repeated.Amount != payment.Amount {
+		t.Errorf("POST /payments/{id}/repeat: status %v, payment = %v", code, repeated)
+		return
+	}
+
+	if code := doJSON(t, http.MethodGet, accountURL, nil, &account); code != http.StatusOK {
+		t.Errorf("GET /accounts/{id}: want status %v got %v", http.StatusOK, code)
+		return
+	}
+	if account.Balance != 2_000_00 {
+		t.Errorf("GET /accounts/{id}: want balance %v got %v", types.Money(2_000_00), account.Balance)
+		return
+	}
+
+	//отменённый платёж в лимит не входит
+	var usages []wallet.LimitUsage
+	code = doJSON(t, http.MethodPost, accountURL+"/limits", map[string]interface{}{"category": "auto", "period": "month", "amount": 10_000_00}, &usages)
+	if code != http.StatusOK || len(usages) != 1 || usages[0].Used != 8_000_00 || usages[0].Remaining != 2_000_00 {
+		t.Errorf("POST /accounts/{id}/limits: status %v, usages = %+v", code, usages)
+	}
+
+	var report []wallet.BudgetStatus
+	code = doJSON(t, http.MethodPost, accountURL+"/budgets", map[string]interface{}{"category": "auto", "amount": 10_000_00}, &report)
+	if code != http.StatusOK || len(report) != 1 || report[0].Spent != 8_000_00 || report[0].Percent != 80 {
+		t.Errorf("POST /accounts/{id}/budgets: status %v, report = %+v", code, report)
+	}
+}
+
+func TestServer_budgetsMonth(t *testing.T) {
+	svc := &wallet.Service{}
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	svc.SetClock(func() time.Time { return now })
+	ts := httptest.NewServer(New(svc))
+	defer ts.Close()
+
+	account, err := svc.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pay(account.ID, 300_00, "food"); err != nil {
+		t.Fatal(err)
+	}
+
+	//без month отчёт за месяц по часам сервиса, а не по часам сервера
+	var report []wallet.BudgetStatus
+	url := ts.URL + "/accounts/" + strconv.FormatInt(account.ID, 10) + "/budgets"
+	code := doJSON(t, http.MethodPost, url, map[string]interface{}{"category": "food", "amount": 1_000_00}, &report)
+	november := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	if code != http.StatusOK || len(report) != 1 || !report[0].Month.Equal(november) || report[0].Spent != 300_00 {
+		t.Errorf("POST /accounts/{id}/budgets: want November with 30000 spent, got %v %+v", code, report)
+	}
+}
+
+func TestServer_errorStatuses(t *testing.T) {
+	svc := &wallet.Service{}
+	svc.SetFraudRules(wallet.CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: wallet.DecisionDeny})
+	ts := httptest.NewServer(New(svc))
+	defer ts.Close()
+
+	doJSON(t, http.MethodPost, ts.URL+"/accounts", map[string]string{"phone": "+992901000876"}, nil)
+	if err := svc.SetLimit(wallet.Limit{AccountID: 1, Category: "fun", Period: wallet.LimitMonthly, Amount: 100_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"account not found", http.MethodGet, "/accounts/42", nil, http.StatusNotFound},
+		{"invalid account id", http.MethodGet, "/accounts/abc", nil, http.StatusBadRequest},
+		{"payment not found", http.MethodGet, "/payments/unknown", nil, http.StatusNotFound},
+		{"reject unknown payment", http.MethodPost, "/payments/unknown/reject", nil, http.StatusNotFound},
+		{"confirm unknown payment", http.MethodPost, "/payments/unknown/confirm", nil, http.StatusNotFound},
+		{"favorite not found", http.MethodPost, "/favorites/unknown/pay", nil, http.StatusNotFound},
+		{"phone registered", http.MethodPost, "/accounts", map[string]string{"phone": "+992901000876"}, http.StatusConflict},
+		{"amount not positive", http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 0}, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/payments", map[string]interface{}{"account": 1}, http.StatusBadRequest},
+		{"method not allowed", http.MethodGet, "/payments", nil, http.StatusMethodNotAllowed},
+		{"payment denied", http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 100, "category": "casino"}, http.StatusForbidden},
+		{"limit exceeded", http.MethodPost, "/payments", map[string]interface{}{"accountId": 1, "amount": 100_01, "category": "fun"}, http.StatusUnprocessableEntity},
+		{"limits of unknown account", http.MethodGet, "/accounts/42/limits", nil, http.StatusNotFound},
+		{"limit for unknown account", http.MethodPost, "/accounts/42/limits", map[string]interface{}{"period": "day", "amount": 100}, http.StatusNotFound},
+		{"invalid limit period", http.MethodPost, "/accounts/1/limits", map[string]interface{}{"period": "week", "amount": 100}, http.StatusBadRequest},
+		{"limits with DELETE", http.MethodDelete, "/accounts/1/limits", nil, http.StatusMethodNotAllowed},
+		{"invalid budget month", http.MethodGet, "/accounts/1/budgets?month=11.2020", nil, http.StatusBadRequest},
+		{"budget not positive", http.MethodPost, "/accounts/1/budgets", map[string]interface{}{"category": "fun", "amount": 0}, http.StatusBadRequest},
+		{"budget for unknown account", http.MethodPost, "/accounts/42/budgets", map[string]interface{}{"category": "fun", "amount": 100}, http.StatusNotFound},
+		{"invalid fees month", http.MethodGet, "/fees?month=2020-13", nil, http.StatusBadRequest},
+		{"invalid fraud attempts account", http.MethodGet, "/fraud/attempts?account=abc", nil, http.StatusBadRequest},
+		{"accrue interest with GET", http.MethodGet, "/interest/accrue", nil, http.StatusMethodNotAllowed},
+		{"invalid statement format", http.MethodGet, "/accounts/1/statement?format=pdf", nil, http.StatusBadRequest},
+		{"statement of unknown account", http.MethodGet, "/accounts/42/statement", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		var resp errorResponse
+		code := doJSON(t, tt.method, ts.URL+tt.path, tt.body, &resp)
+		if code != tt.want {
+			t.Errorf("%s: want status %v got %v (%v)", tt.name, tt.want, code, resp.Error)
+		}
+		if resp.Error == "" {
+			t.Errorf("%s: error message is empty", tt.name)
+		}
+	}
+
+	//отклонённый платёж остаётся в списке попыток
+	var attempts []wallet.FraudAttempt
+	code := doJSON(t, http.MethodGet, ts.URL+"/fraud/attempts?account=1", nil, &attempts)
+	if code != http.StatusOK || len(attempts) != 1 || attempts[0].Category != "casino" || attempts[0].Decision != wallet.DecisionDeny {
+		t.Errorf("GET /fraud/attempts: want one denied casino payment, got %v %+v", code, attempts)
+	}
+}
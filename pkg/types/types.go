@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 //Money - представляет собой денежную сумму в минимальных единицах (центы копейки, дирамы и т.д)
 type Money int64
 
@@ -32,11 +34,14 @@ type Card struct {
 
 //Payment представляет информацию о платеже 
 type Payment struct {
-	ID 			string
-	AccountID	int64
-	Amount 		Money
-	Category 	PaymentCategory
-	Status 		PaymentStatus
+	ID 			string			`json:"id"`
+	AccountID	int64			`json:"accountId"`
+	Amount 		Money			`json:"amount"`
+	Category 	PaymentCategory	`json:"category"`
+	Status 		PaymentStatus	`json:"status"`
+	Updated		time.Time		`json:"updated"` // время последнего изменения
+	Created		time.Time		`json:"created"` // время создания, нулевое если не известно
+	FavoriteID	string			`json:"favoriteId,omitempty"` // избранное, из которого создан платёж
 }
 
 //PaymentSource представляет информацию короткую инфо о картах пользователья 
@@ -53,9 +58,12 @@ type Phone string
 
 // Accounts
 type Account struct {
-	ID int64 // 'card'
-	Phone Phone // номер вида '5058 xxxx xxxx 8888'
-	Balance Money // баланс в дирамах
+	ID int64 `json:"id"` // 'card'
+	Phone Phone `json:"phone"` // номер вида '5058 xxxx xxxx 8888'
+	Balance Money `json:"balance"` // баланс в дирамах
+	Bonus Money `json:"bonus"` // бонусный баланс, начисляемый кэшбэком
+	Updated time.Time `json:"updated"` // время последнего изменения
+	Created time.Time `json:"created"` // время регистрации, нулевое если не известно
 }
 
 type PaymentCategory string
@@ -69,13 +77,38 @@ const (
 	PaymentStatusInProgress PaymentStatus = "INPROGRESS"
 )
 
+//EntryKind - вид проводки по счёту
+type EntryKind string
+
+//Виды проводок
+const (
+	EntryDeposit EntryKind = "deposit" // пополнение счёта
+	EntryCashback EntryKind = "cashback" // начисление кэшбэка на бонусный баланс
+	EntryClawback EntryKind = "clawback" // списание кэшбэка отменённого платежа
+	EntryFee EntryKind = "fee" // комиссия за платёж, списывается с баланса вместе с платежом
+	EntryFeeRefund EntryKind = "fee_refund" // возврат комиссии отменённого платежа
+	EntryInterest EntryKind = "interest" // капитализация начисленных за месяц процентов
+)
+
+//Entry представляет проводку по счёту, не являющуюся платежом
+type Entry struct {
+	ID			string		`json:"id"`
+	AccountID	int64		`json:"accountId"`
+	Kind		EntryKind	`json:"kind"`
+	Amount		Money		`json:"amount"` // всегда положительная, направление задаёт Kind
+	PaymentID	string		`json:"paymentId,omitempty"` // платёж, к которому относится проводка
+	Note		string		`json:"note,omitempty"`
+	Created		time.Time	`json:"created"`
+}
+
 //Favorite представляет инфо о избранном платеже
 type Favorite struct {
-	ID 			string
-	AccountID	int64
-	Name		string
-	Amount		Money
-	Category	PaymentCategory
+	ID 			string			`json:"id"`
+	AccountID	int64			`json:"accountId"`
+	Name		string			`json:"name"`
+	Amount		Money			`json:"amount"`
+	Category	PaymentCategory	`json:"category"`
+	Updated		time.Time		`json:"updated"` // время последнего изменения
 }
 
 type Progress struct{
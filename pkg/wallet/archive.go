@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+//Архив ExportTo: строка archiveMagic и файлы выгрузки. Файл - строка с его
+//именем и содержимое блоками: uint32 длины блока и сам блок, блок нулевой длины
+//завершает файл. Пустая строка вместо имени завершает архив, поэтому обрезанный
+//поток обнаруживается. Манифест пишется последним, когда известны суммы файлов
+const (
+	archiveMagic     = "#wallet-archive 1\n"
+	archiveBlockSize = 32 * 1024
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+type archiveWriter struct {
+	w *bufio.Writer
+}
+
+func newArchiveWriter(w io.Writer) (*archiveWriter, error) {
+	archive := &archiveWriter{w: bufio.NewWriterSize(w, archiveBlockSize)}
+	if _, err := archive.w.WriteString(archiveMagic); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+//create пишет файл name содержимым из write и возвращает SHA-256 содержимого
+func (a *archiveWriter) create(name string, write func(w io.Writer) error) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\r\n") {
+		return "", fmt.Errorf("invalid archive entry name %q", name)
+	}
+	if _, err := a.w.WriteString(name + "\n"); err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	blocks := bufio.NewWriterSize(blockWriter{a.w}, archiveBlockSize)
+	if err := write(io.MultiWriter(blocks, hasher)); err != nil {
+		return "", err
+	}
+	if err := blocks.Flush(); err != nil {
+		return "", err
+	}
+	if err := writeBlockSize(a.w, 0); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+//close завершает архив, но не закрывает нижележащий writer
+func (a *archiveWriter) close() error {
+	if err := a.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return a.w.Flush()
+}
+
+//blockWriter пишет каждый вызов Write блоками не длиннее archiveBlockSize
+type blockWriter struct {
+	w io.Writer
+}
+
+func (b blockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		block := p
+		if len(block) > archiveBlockSize {
+			block = block[:archiveBlockSize]
+		}
+		if err := writeBlockSize(b.w, len(block)); err != nil {
+			return written, err
+		}
+		n, err := b.w.Write(block)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(block):]
+	}
+	return written, nil
+}
+
+func writeBlockSize(w io.Writer, size int) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(size))
+	_, err := w.Write(header[:])
+	return err
+}
+
+type archiveReader struct {
+	r     *bufio.Reader
+	entry *blockReader
+}
+
+func newArchiveReader(r io.Reader) (*archiveReader, error) {
+	buffered := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(buffered, magic); err != nil || string(magic) != archiveMagic {
+		return nil, fmt.Errorf("%w: no archive header", ErrInvalidArchive)
+	}
+	return &archiveReader{r: buffered}, nil
+}
+
+//next пропускает непрочитанный остаток текущего файла и возвращает имя и
+//содержимое следующего. В конце архива возвращается io.EOF
+func (a *archiveReader) next() (string, io.Reader, error) {
+	if a.entry != nil {
+		if _, err := io.Copy(ioutil.Discard, a.entry); err != nil {
+			return "", nil, err
+		}
+		a.entry = nil
+	}
+
+	line, err := a.r.ReadSlice('\n')
+	if err == io.EOF {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	name := strings.TrimSuffix(string(line), "\n")
+	if name == "" {
+		return "", nil, io.EOF
+	}
+	a.entry = &blockReader{r: a.r}
+	return name, a.entry, nil
+}
+
+//blockReader читает содержимое файла архива до блока нулевой длины
+type blockReader struct {
+	r         io.Reader
+	remaining uint32
+	done      bool
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, io.EOF
+	}
+	if b.remaining == 0 {
+		var header [4]byte
+		if _, err := io.ReadFull(b.r, header[:]); err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.remaining = binary.BigEndian.Uint32(header[:])
+		if b.remaining == 0 {
+			b.done = true
+			return 0, io.EOF
+		}
+	}
+
+	if uint32(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+//ExportTo пишет все секции и манифест одним архивом в w, например в pipe или
+//тело HTTP-ответа. Опции те же, что у Export
+func (s *Service) ExportTo(w io.Writer, opts ...Option) error {
+	return s.ExportToContext(context.Background(), w, opts...)
+}
+
+func (s *Service) ExportToContext(ctx context.Context, w io.Writer, opts ...Option) error {
+	err := s.exportTo(ctx, w, newOptions(opts))
+	err = s.runHooks(ctx, OpExportTo, err)
+	return err
+}
+
+func (s *Service) exportTo(ctx context.Context, w io.Writer, o options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	archive, err := newArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := exportSections(ctx, s.snapshot(), o, archive.create)
+	if err != nil {
+		return err
+	}
+	if _, err := archive.create(manifestName(o.format), manifest.encode); err != nil {
+		return err
+	}
+	return archive.close()
+}
+
+//ImportFrom читает архив ExportTo из r. Как и Import, сначала читает весь
+//архив и только потом меняет сервис
+func (s *Service) ImportFrom(r io.Reader, opts ...Option) error {
+	return s.ImportFromContext(context.Background(), r, opts...)
+}
+
+func (s *Service) ImportFromContext(ctx context.Context, r io.Reader, opts ...Option) error {
+	err := s.importFrom(ctx, r, newOptions(opts))
+	err = s.runHooks(ctx, OpImportFrom, err)
+	return err
+}
+
+func (s *Service) importFrom(ctx context.Context, r io.Reader, o options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	snap, mismatches, err := scanArchive(ctx, r, o, nil)
+	if err == nil {
+		err = checkMismatches("archive", mismatches, o)
+	}
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	return s.mergeImported(snap, o)
+}
+
+//scanArchive читает все секции архива в снапшот и возвращает расхождения с манифестом
+func scanArchive(ctx context.Context, r io.Reader, o options, onRecord onSectionRecord) (*snapshot, []ManifestMismatch, error) {
+	archive, err := newArchiveReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest *Manifest
+	snap := &snapshot{}
+	files := make(map[string]sectionFile)
+	for {
+		name, entry, err := archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if name == manifestName(o.format) {
+			if o.manifest == ManifestIgnore {
+				continue
+			}
+			manifest, err = decodeManifest(entry, o.format)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		sec, ok := sectionByFile(name, o.format)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: unexpected file %q", ErrInvalidArchive, name)
+		}
+		if _, ok := files[name]; ok {
+			return nil, nil, fmt.Errorf("%w: duplicate file %q", ErrInvalidArchive, name)
+		}
+		files[name], err = readSection(ctx, entry, name, sec, snap, o, onRecord)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if manifest == nil && o.manifest == ManifestRequire {
+		return nil, nil, fmt.Errorf("archive: %w", ErrManifestNotFound)
+	}
+
+	mismatches, err := checkSections(manifest, files, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, mismatches, nil
+}
+
+//sectionByFile возвращает секцию, которую хранит файл name в формате format
+func sectionByFile(name string, format Format) (section, bool) {
+	for _, sec := range sections {
+		if sec.name+format.ext() == name {
+			return sec, true
+		}
+	}
+	return section{}, false
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestService_ExportTo_roundTrip(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Fatal(err)
+	}
+
+	variants := [][]Option{
+		{WithFormat(FormatDump)},
+		{WithFormat(FormatJSON)},
+		{WithFormat(FormatJSONLines), WithEncryption(testKeys)},
+	}
+	for _, opts := range variants {
+		var buf bytes.Buffer
+		if err := s.ExportTo(&buf, opts...); err != nil {
+			t.Errorf("ExportTo(): error = %v", err)
+			continue
+		}
+
+		imported := newTestService()
+		if err := imported.ImportFrom(&buf, append(opts, WithManifestPolicy(ManifestRequire))...); err != nil {
+			t.Errorf("ImportFrom(): error = %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(s.snapshot(), imported.snapshot()) {
+			t.Errorf("ImportFrom(): want %v got %v", s.snapshot(), imported.snapshot())
+		}
+	}
+}
+
+func TestService_ImportFrom_pipe(t *testing.T) {
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(s.ExportTo(writer))
+	}()
+
+	imported := newTestService()
+	if err := imported.ImportFrom(reader); err != nil {
+		t.Errorf("ImportFrom(): error = %v", err)
+		return
+	}
+	if len(imported.accounts) != 1 || len(imported.payments) != 1 || len(imported.favorites) != 1 {
+		t.Errorf("ImportFrom(): want %v got %v", s.snapshot(), imported.snapshot())
+		return
+	}
+}
+
+func TestService_ImportFrom_damaged(t *testing.T) {
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	//изменённая сумма счёта не совпадает с манифестом
+	changed := bytes.Replace(archive, []byte(";0;"), []byte(";9;"), 1)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "truncated", data: archive[:len(archive)-1], want: io.ErrUnexpectedEOF},
+		{name: "changed", data: changed, want: ErrManifestMismatch},
+		{name: "not archive", data: []byte("1;+992901000876;0;\n"), want: ErrInvalidArchive},
+	}
+	for _, test := range tests {
+		imported := newTestService()
+		err := imported.ImportFrom(bytes.NewReader(test.data))
+		if !errors.Is(err, test.want) {
+			t.Errorf("ImportFrom(%s): must return %v, returned = %v", test.name, test.want, err)
+		}
+		if len(imported.accounts) != 0 {
+			t.Errorf("ImportFrom(%s): service changed on error", test.name)
+		}
+	}
+}
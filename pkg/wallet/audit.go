@@ -0,0 +1,239 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+var ErrAuditTampered = errors.New("audit log is tampered")
+var ErrAuditWrite = errors.New("audit log write failed")
+
+//AuditRecord - изменение одной записи сервиса. Hash - SHA-256 записи без поля
+//Hash, а PrevHash - хеш предыдущей записи, поэтому правка, удаление или
+//перестановка записей обнаруживается VerifyAudit
+type AuditRecord struct {
+	Seq       uint64          `json:"seq"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor,omitempty"`
+	TraceID   string          `json:"traceId,omitempty"`
+	Operation Operation       `json:"operation"`
+	Entity    string          `json:"entity"`
+	ID        string          `json:"id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	PrevHash  string          `json:"prevHash"`
+	Hash      string          `json:"hash,omitempty"`
+}
+
+//sum возвращает хеш записи без поля Hash
+func (r AuditRecord) sum() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//AuditLog дописывает цепочку записей аудита JSON-строками в w. В памяти
+//хранится только последняя запись, нужная для связи со следующей
+type AuditLog struct {
+	w       io.Writer
+	lastSeq uint64
+	last    string // хеш последней записи
+	err     error  // первая ошибка записи: после неё цепочка в w неполна
+}
+
+//NewAuditLog начинает новую цепочку. w может быть nil, тогда записи только связываются и никуда не пишутся
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+//ResumeAuditLog проверяет цепочку, ранее записанную в r, и продолжает её в w
+func ResumeAuditLog(r io.Reader, w io.Writer) (*AuditLog, error) {
+	records, err := ReadAudit(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyAudit(records); err != nil {
+		return nil, err
+	}
+
+	audit := &AuditLog{w: w}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		audit.lastSeq, audit.last = last.Seq, last.Hash
+	}
+	return audit, nil
+}
+
+//Records читает записи цепочки из w. w должен поддерживать io.ReaderAt, как *os.File
+func (l *AuditLog) Records() ([]AuditRecord, error) {
+	r, ok := l.w.(io.ReaderAt)
+	if !ok {
+		return nil, fmt.Errorf("audit log %T is not readable", l.w)
+	}
+	return ReadAudit(io.NewSectionReader(r, 0, math.MaxInt64))
+}
+
+//Err возвращает ошибку, после которой аудит перестал записываться
+func (l *AuditLog) Err() error {
+	return l.err
+}
+
+//append связывает record с последней записью цепочки и пишет её в w. После
+//первой ошибки записи цепочка в w неполна, поэтому следующие записи не пишутся
+func (l *AuditLog) append(record AuditRecord) error {
+	if l.err != nil {
+		return l.err
+	}
+	record.Seq = l.lastSeq + 1
+	record.PrevHash = l.last
+
+	var err error
+	if record.Hash, err = record.sum(); err != nil {
+		return err
+	}
+
+	if l.w != nil {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := l.w.Write(append(data, '\n')); err != nil {
+			l.err = fmt.Errorf("%w: record %d: %v", ErrAuditWrite, record.Seq, err)
+			return l.err
+		}
+	}
+	l.lastSeq, l.last = record.Seq, record.Hash
+	return nil
+}
+
+//ReadAudit читает записи аудита, записанные AuditLog
+func ReadAudit(r io.Reader) ([]AuditRecord, error) {
+	var records []AuditRecord
+	err := readLines(context.Background(), r, func(line int, text string) error {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return &ParseError{Line: line, Text: clipRecord(text), Err: err}
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+//VerifyAudit проверяет хеши и связи записей цепочки от её начала: первая
+//запись должна иметь Seq 1 и пустой PrevHash, иначе удалены старые записи
+func VerifyAudit(records []AuditRecord) error {
+	return VerifyAuditFrom(records, 0, "")
+}
+
+//VerifyAuditFrom проверяет часть цепочки, продолжающую запись с номером seq и
+//хешем hash: например, уже проверенный и перенесённый в архив журнал
+func VerifyAuditFrom(records []AuditRecord, seq uint64, hash string) error {
+	for _, record := range records {
+		sum, err := record.sum()
+		if err != nil {
+			return err
+		}
+		if sum != record.Hash {
+			return fmt.Errorf("%w: record %d: hash mismatch", ErrAuditTampered, record.Seq)
+		}
+		if record.PrevHash != hash {
+			return fmt.Errorf("%w: record %d: previous hash mismatch", ErrAuditTampered, record.Seq)
+		}
+		if record.Seq != seq+1 {
+			return fmt.Errorf("%w: record %d follows record %d", ErrAuditTampered, record.Seq, seq)
+		}
+		seq, hash = record.Seq, record.Hash
+	}
+	return nil
+}
+
+//SetAuditLog включает аудит изменений сервиса. nil выключает аудит
+func (s *Service) SetAuditLog(audit *AuditLog) {
+	s.audit = audit
+	s.changes = nil
+}
+
+//change - изменение записи, ожидающее записи в аудит по завершении операции
+type change struct {
+	entity string
+	id     string
+	before interface{}
+	after  interface{}
+	always bool // пишется и при ошибке операции
+}
+
+//track запоминает изменение записи для аудита. before или after - nil для
+//созданных и удалённых записей
+func (s *Service) track(entity string, id string, before interface{}, after interface{}) {
+	if s.audit == nil {
+		return
+	}
+	s.changes = append(s.changes, change{entity: entity, id: id, before: before, after: after})
+}
+
+//trackAlways запоминает изменение, которое остаётся в силе и при ошибке
+//операции, например запись об отклонённом платеже
+func (s *Service) trackAlways(entity string, id string, before interface{}, after interface{}) {
+	if s.audit == nil {
+		return
+	}
+	s.changes = append(s.changes, change{entity: entity, id: id, before: before, after: after, always: true})
+}
+
+//commitAudit пишет изменения завершённой операции в аудит с инициатором из ctx.
+//От неудавшейся операции пишутся только изменения, отмеченные trackAlways.
+//Ошибка записи не отменяет операцию, но возвращается вызывающему, чтобы
+//изменение без следа в аудите не осталось незамеченным
+func (s *Service) commitAudit(ctx context.Context, op Operation, err error) error {
+	changes := s.changes
+	s.changes = nil
+	if s.audit == nil {
+		return nil
+	}
+
+	now := s.now()
+	for _, change := range changes {
+		if err != nil && !change.always {
+			continue
+		}
+		record := AuditRecord{
+			Time:      now,
+			Actor:     ActorFromContext(ctx),
+			TraceID:   TraceIDFromContext(ctx),
+			Operation: op,
+			Entity:    change.entity,
+			ID:        change.id,
+		}
+
+		var merr error
+		if record.Before, merr = marshalAudit(change.before); merr == nil {
+			record.After, merr = marshalAudit(change.after)
+		}
+		if merr == nil {
+			merr = s.audit.append(record)
+		}
+		if merr != nil {
+			return fmt.Errorf("audit %s %s %s: %w", op, change.entity, change.id, merr)
+		}
+	}
+	return nil
+}
+
+func marshalAudit(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,210 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestService_audit(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestService()
+	s.SetClock(tickingClock())
+	s.SetAuditLog(NewAuditLog(&buf))
+
+	ctx := WithActor(context.Background(), "operator")
+	account, err := s.RegisterAccountContext(ctx, "+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DepositContext(ctx, account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := s.PayContext(ctx, account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PayContext(ctx, account.ID, 0, "auto"); err != ErrAmountMustBePositive {
+		t.Fatalf("Pay(): want ErrAmountMustBePositive, got %v", err)
+	}
+	if err := s.RejectContext(ctx, payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadAudit(&buf)
+	if err != nil {
+		t.Errorf("ReadAudit(): error = %v", err)
+		return
+	}
+	want := []struct {
+		op     Operation
+		entity string
+	}{
+		{OpRegisterAccount, "account"},
+		{OpDeposit, "account"},
+		{OpDeposit, "entry"},
+		{OpPay, "account"},
+		{OpPay, "payment"},
+		{OpReject, "account"},
+		{OpReject, "payment"},
+	}
+	if len(records) != len(want) {
+		t.Errorf("ReadAudit(): want %v records, got %v", len(want), len(records))
+		return
+	}
+	for i, record := range records {
+		if record.Operation != want[i].op || record.Entity != want[i].entity || record.Actor != "operator" {
+			t.Errorf("record %d: want %v %v by operator, got %+v", i, want[i].op, want[i].entity, record)
+		}
+	}
+
+	var before, after types.Account
+	if err := json.Unmarshal(records[1].Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(records[1].After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Balance != 0 || after.Balance != 1_000_00 {
+		t.Errorf("deposit record: want balance 0 -> 100000, got %v -> %v", before.Balance, after.Balance)
+	}
+	if records[0].Before != nil {
+		t.Errorf("register record: want no before, got %s", records[0].Before)
+	}
+
+	if err := VerifyAudit(records); err != nil {
+		t.Errorf("VerifyAudit(): error = %v", err)
+	}
+}
+
+func TestVerifyAudit_tampered(t *testing.T) {
+	file, err := ioutil.TempFile("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	s := newTestService()
+	audit := NewAuditLog(file)
+	s.SetAuditLog(audit)
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Deposit(account.ID, 100_00); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Records читает записи из файла, а не из памяти
+	records := func() []AuditRecord {
+		records, err := audit.Records()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	if err := VerifyAudit(records()); err != nil {
+		t.Fatalf("VerifyAudit(): error = %v", err)
+	}
+
+	edited := records()
+	edited[2].After = json.RawMessage(`{"id":1,"phone":"+992901000876","balance":9999999}`)
+	reordered := records()
+	reordered[1], reordered[2] = reordered[2], reordered[1]
+	deleted := append(records()[:1], records()[2:]...)
+	rehashed := records()
+	rehashed[1].Actor = "intruder"
+	rehashed[1].Hash, _ = rehashed[1].sum()
+
+	tests := map[string][]AuditRecord{
+		"edited":    edited,
+		"reordered": reordered,
+		"deleted":   deleted,
+		"rehashed":  rehashed,
+		"truncated": records()[2:],
+	}
+	for name, records := range tests {
+		if err := VerifyAudit(records); !errors.Is(err, ErrAuditTampered) {
+			t.Errorf("VerifyAudit(%s): want ErrAuditTampered, got %v", name, err)
+		}
+	}
+
+	//продолжение цепочки проверяется от известной записи
+	anchor := records()[1]
+	if err := VerifyAuditFrom(records()[2:], anchor.Seq, anchor.Hash); err != nil {
+		t.Errorf("VerifyAuditFrom(): error = %v", err)
+	}
+	if err := VerifyAuditFrom(records()[3:], anchor.Seq, anchor.Hash); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("VerifyAuditFrom(): want ErrAuditTampered for a gap, got %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestService_audit_writeError(t *testing.T) {
+	s := newTestService()
+	audit := NewAuditLog(failingWriter{})
+	s.SetAuditLog(audit)
+
+	//операция применена, но вызывающий узнаёт, что она не попала в аудит
+	account, err := s.RegisterAccount("+992901000876")
+	if !errors.Is(err, ErrAuditWrite) {
+		t.Errorf("RegisterAccount(): want ErrAuditWrite, got %v", err)
+	}
+	if account == nil {
+		t.Fatal("RegisterAccount(): account must be registered")
+	}
+	if err := s.Deposit(account.ID, 100_00); !errors.Is(err, ErrAuditWrite) {
+		t.Errorf("Deposit(): want ErrAuditWrite, got %v", err)
+	}
+	if !errors.Is(audit.Err(), ErrAuditWrite) {
+		t.Errorf("Err(): want ErrAuditWrite, got %v", audit.Err())
+	}
+}
+
+func TestResumeAuditLog(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestService()
+	s.SetAuditLog(NewAuditLog(&buf))
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit, err := ResumeAuditLog(bytes.NewReader(buf.Bytes()), &buf)
+	if err != nil {
+		t.Errorf("ResumeAuditLog(): error = %v", err)
+		return
+	}
+	s.SetAuditLog(audit)
+	if err := s.Deposit(account.ID, 100_00); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadAudit(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//пополнение записывает счёт и проводку
+	if len(records) != 3 || records[1].Seq != 2 {
+		t.Errorf("ResumeAuditLog(): want chain of 3 records, got %+v", records)
+		return
+	}
+	if err := VerifyAudit(records); err != nil {
+		t.Errorf("VerifyAudit(): error = %v", err)
+	}
+}
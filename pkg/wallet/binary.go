@@ -0,0 +1,683 @@
+package wallet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+//Файл FormatBinary: binaryMagic, версия, имя секции, число записей и записи.
+//Числа пишутся varint, строки - длиной и байтами, время - наносекундами Unix.
+//ID в виде UUID занимают 16 байт, а категории и статусы кодируются словарём:
+//номер значения, а при первом появлении ещё и само значение
+const (
+	binaryMagic   = "WALLETBIN"
+	BinaryVersion = 4
+)
+
+//Версии FormatBinary, в которых у записей появились поля
+const (
+	createdBinaryVersion  = 2 // время создания счетов и платежей
+	bonusBinaryVersion    = 3 // бонусный баланс счетов
+	favoriteBinaryVersion = 4 // избранное, из которого создан платёж
+)
+
+var ErrInvalidBinary = errors.New("invalid binary snapshot")
+
+//Варианты кодирования ID
+const (
+	binaryIDUUID   = 0 // 16 байт UUID в каноническом виде
+	binaryIDString = 1 // строка
+)
+
+type binaryEncoder struct {
+	w       io.Writer
+	scratch [binary.MaxVarintLen64]byte
+	dicts   map[string]map[string]uint64
+}
+
+func newBinaryEncoder(w io.Writer) *binaryEncoder {
+	return &binaryEncoder{w: w, dicts: make(map[string]map[string]uint64)}
+}
+
+func (e *binaryEncoder) uvarint(v uint64) error {
+	n := binary.PutUvarint(e.scratch[:], v)
+	_, err := e.w.Write(e.scratch[:n])
+	return err
+}
+
+func (e *binaryEncoder) varint(v int64) error {
+	n := binary.PutVarint(e.scratch[:], v)
+	_, err := e.w.Write(e.scratch[:n])
+	return err
+}
+
+func (e *binaryEncoder) string(s string) error {
+	if err := e.uvarint(uint64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+func (e *binaryEncoder) time(t time.Time) error {
+	if t.IsZero() {
+		return e.varint(0)
+	}
+	return e.varint(t.UnixNano())
+}
+
+//id пишет 16 байт UUID, если id - UUID в каноническом виде, иначе строку
+func (e *binaryEncoder) id(id string) error {
+	parsed, err := uuid.Parse(id)
+	if err != nil || parsed.String() != id {
+		if _, err := e.w.Write([]byte{binaryIDString}); err != nil {
+			return err
+		}
+		return e.string(id)
+	}
+
+	if _, err := e.w.Write([]byte{binaryIDUUID}); err != nil {
+		return err
+	}
+	_, err = e.w.Write(parsed[:])
+	return err
+}
+
+//word пишет номер value в словаре dict, а новое значение - ещё и строкой
+func (e *binaryEncoder) word(dict string, value string) error {
+	words, ok := e.dicts[dict]
+	if !ok {
+		words = make(map[string]uint64)
+		e.dicts[dict] = words
+	}
+
+	index, ok := words[value]
+	if ok {
+		return e.uvarint(index)
+	}
+	index = uint64(len(words))
+	words[value] = index
+	if err := e.uvarint(index); err != nil {
+		return err
+	}
+	return e.string(value)
+}
+
+type binaryDecoder struct {
+	r      *bufio.Reader
+	offset int64
+	dicts  map[string][]string
+	buf    []byte
+	//version - версия читаемого файла, известна после readBinaryHeader
+	version uint64
+}
+
+func newBinaryDecoder(r io.Reader) *binaryDecoder {
+	return &binaryDecoder{r: bufio.NewReader(r), dicts: make(map[string][]string)}
+}
+
+func (d *binaryDecoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == nil {
+		d.offset++
+	}
+	return b, err
+}
+
+func (d *binaryDecoder) read(p []byte) error {
+	n, err := io.ReadFull(d.r, p)
+	d.offset += int64(n)
+	return unexpectedEOF(err)
+}
+
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(d)
+	return v, unexpectedEOF(err)
+}
+
+func (d *binaryDecoder) varint() (int64, error) {
+	v, err := binary.ReadVarint(d)
+	return v, unexpectedEOF(err)
+}
+
+func (d *binaryDecoder) string() (string, error) {
+	size, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if size > MaxRecordSize {
+		return "", fmt.Errorf("%w: string of %d bytes", ErrRecordTooLong, size)
+	}
+
+	if uint64(cap(d.buf)) < size {
+		d.buf = make([]byte, size)
+	}
+	data := d.buf[:size]
+	if err := d.read(data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (d *binaryDecoder) time() (time.Time, error) {
+	nanos, err := d.varint()
+	if err != nil || nanos == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+func (d *binaryDecoder) id() (string, error) {
+	kind, err := d.ReadByte()
+	if err != nil {
+		return "", unexpectedEOF(err)
+	}
+
+	switch kind {
+	case binaryIDUUID:
+		var id uuid.UUID
+		if err := d.read(id[:]); err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	case binaryIDString:
+		return d.string()
+	default:
+		return "", fmt.Errorf("%w: id kind %d", ErrInvalidBinary, kind)
+	}
+}
+
+func (d *binaryDecoder) word(dict string) (string, error) {
+	index, err := d.uvarint()
+	if err != nil {
+		return "", err
+	}
+
+	words := d.dicts[dict]
+	switch {
+	case index < uint64(len(words)):
+		return words[index], nil
+	case index == uint64(len(words)):
+		value, err := d.string()
+		if err != nil {
+			return "", err
+		}
+		d.dicts[dict] = append(words, value)
+		return value, nil
+	default:
+		return "", fmt.Errorf("%w: %s %d is not in dictionary", ErrInvalidBinary, dict, index)
+	}
+}
+
+//unexpectedEOF заменяет io.EOF внутри записи на io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+//writeBinaryHeader пишет заголовок файла секции name с count записями
+func writeBinaryHeader(enc *binaryEncoder, name string, count int) error {
+	if _, err := io.WriteString(enc.w, binaryMagic); err != nil {
+		return err
+	}
+	if err := enc.uvarint(BinaryVersion); err != nil {
+		return err
+	}
+	if err := enc.string(name); err != nil {
+		return err
+	}
+	return enc.uvarint(uint64(count))
+}
+
+//readBinaryHeader проверяет заголовок файла секции name и возвращает число записей
+func readBinaryHeader(dec *binaryDecoder, name string) (uint64, error) {
+	magic := make([]byte, len(binaryMagic))
+	if err := dec.read(magic); err != nil || string(magic) != binaryMagic {
+		return 0, fmt.Errorf("%w: no header", ErrInvalidBinary)
+	}
+
+	version, err := dec.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if version < 1 || version > BinaryVersion {
+		return 0, fmt.Errorf("%w %d, newest known is %d", ErrUnsupportedVersion, version, BinaryVersion)
+	}
+	dec.version = version
+
+	section, err := dec.string()
+	if err != nil {
+		return 0, err
+	}
+	if section != name {
+		return 0, fmt.Errorf("%w: file is for %q, want %q", ErrInvalidBinary, section, name)
+	}
+	return dec.uvarint()
+}
+
+func writeAccountBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	account := snap.accounts[i]
+	if err := enc.varint(account.ID); err != nil {
+		return err
+	}
+	if err := enc.string(string(account.Phone)); err != nil {
+		return err
+	}
+	if err := enc.varint(int64(account.Balance)); err != nil {
+		return err
+	}
+	if err := enc.time(account.Updated); err != nil {
+		return err
+	}
+	if err := enc.time(account.Created); err != nil {
+		return err
+	}
+	return enc.varint(int64(account.Bonus))
+}
+
+func readAccountBinary(snap *snapshot, dec *binaryDecoder) error {
+	account := &types.Account{}
+	var err error
+	if account.ID, err = dec.varint(); err != nil {
+		return err
+	}
+	phone, err := dec.string()
+	if err != nil {
+		return err
+	}
+	account.Phone = types.Phone(phone)
+	balance, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	account.Balance = types.Money(balance)
+	if account.Updated, err = dec.time(); err != nil {
+		return err
+	}
+	if dec.version >= createdBinaryVersion {
+		if account.Created, err = dec.time(); err != nil {
+			return err
+		}
+	}
+	if dec.version >= bonusBinaryVersion {
+		bonus, err := dec.varint()
+		if err != nil {
+			return err
+		}
+		account.Bonus = types.Money(bonus)
+	}
+
+	snap.accounts = append(snap.accounts, account)
+	return nil
+}
+
+func writePaymentBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	payment := snap.payments[i]
+	if err := enc.id(payment.ID); err != nil {
+		return err
+	}
+	if err := enc.varint(payment.AccountID); err != nil {
+		return err
+	}
+	if err := enc.varint(int64(payment.Amount)); err != nil {
+		return err
+	}
+	if err := enc.word("category", string(payment.Category)); err != nil {
+		return err
+	}
+	if err := enc.word("status", string(payment.Status)); err != nil {
+		return err
+	}
+	if err := enc.time(payment.Updated); err != nil {
+		return err
+	}
+	if err := enc.time(payment.Created); err != nil {
+		return err
+	}
+	return enc.string(payment.FavoriteID)
+}
+
+func readPaymentBinary(snap *snapshot, dec *binaryDecoder) error {
+	payment := &types.Payment{}
+	var err error
+	if payment.ID, err = dec.id(); err != nil {
+		return err
+	}
+	if payment.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	payment.Amount = types.Money(amount)
+	category, err := dec.word("category")
+	if err != nil {
+		return err
+	}
+	payment.Category = types.PaymentCategory(category)
+	status, err := dec.word("status")
+	if err != nil {
+		return err
+	}
+	payment.Status = types.PaymentStatus(status)
+	if payment.Updated, err = dec.time(); err != nil {
+		return err
+	}
+	if dec.version >= createdBinaryVersion {
+		if payment.Created, err = dec.time(); err != nil {
+			return err
+		}
+	}
+	if dec.version >= favoriteBinaryVersion {
+		if payment.FavoriteID, err = dec.string(); err != nil {
+			return err
+		}
+	}
+
+	snap.payments = append(snap.payments, payment)
+	return nil
+}
+
+func writeFavoriteBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	favorite := snap.favorites[i]
+	if err := enc.id(favorite.ID); err != nil {
+		return err
+	}
+	if err := enc.varint(favorite.AccountID); err != nil {
+		return err
+	}
+	if err := enc.string(favorite.Name); err != nil {
+		return err
+	}
+	if err := enc.varint(int64(favorite.Amount)); err != nil {
+		return err
+	}
+	if err := enc.word("category", string(favorite.Category)); err != nil {
+		return err
+	}
+	return enc.time(favorite.Updated)
+}
+
+func readFavoriteBinary(snap *snapshot, dec *binaryDecoder) error {
+	favorite := &types.Favorite{}
+	var err error
+	if favorite.ID, err = dec.id(); err != nil {
+		return err
+	}
+	if favorite.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	if favorite.Name, err = dec.string(); err != nil {
+		return err
+	}
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	favorite.Amount = types.Money(amount)
+	category, err := dec.word("category")
+	if err != nil {
+		return err
+	}
+	favorite.Category = types.PaymentCategory(category)
+	if favorite.Updated, err = dec.time(); err != nil {
+		return err
+	}
+
+	snap.favorites = append(snap.favorites, favorite)
+	return nil
+}
+
+func writeEntryBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	entry := snap.entries[i]
+	if err := enc.id(entry.ID); err != nil {
+		return err
+	}
+	if err := enc.varint(entry.AccountID); err != nil {
+		return err
+	}
+	if err := enc.word("kind", string(entry.Kind)); err != nil {
+		return err
+	}
+	if err := enc.varint(int64(entry.Amount)); err != nil {
+		return err
+	}
+	if err := enc.string(entry.PaymentID); err != nil {
+		return err
+	}
+	if err := enc.word("note", entry.Note); err != nil {
+		return err
+	}
+	return enc.time(entry.Created)
+}
+
+func readEntryBinary(snap *snapshot, dec *binaryDecoder) error {
+	entry := &types.Entry{}
+	var err error
+	if entry.ID, err = dec.id(); err != nil {
+		return err
+	}
+	if entry.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	kind, err := dec.word("kind")
+	if err != nil {
+		return err
+	}
+	entry.Kind = types.EntryKind(kind)
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	entry.Amount = types.Money(amount)
+	if entry.PaymentID, err = dec.string(); err != nil {
+		return err
+	}
+	if entry.Note, err = dec.word("note"); err != nil {
+		return err
+	}
+	if entry.Created, err = dec.time(); err != nil {
+		return err
+	}
+
+	snap.entries = append(snap.entries, entry)
+	return nil
+}
+
+func writeFraudAttemptBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	attempt := snap.attempts[i]
+	if err := enc.id(attempt.ID); err != nil {
+		return err
+	}
+	if err := enc.time(attempt.Time); err != nil {
+		return err
+	}
+	if err := enc.varint(attempt.AccountID); err != nil {
+		return err
+	}
+	if err := enc.varint(int64(attempt.Amount)); err != nil {
+		return err
+	}
+	if err := enc.word("category", string(attempt.Category)); err != nil {
+		return err
+	}
+	if err := enc.word("decision", string(attempt.Decision)); err != nil {
+		return err
+	}
+	if err := enc.word("rule", attempt.Rule); err != nil {
+		return err
+	}
+	if err := enc.string(attempt.Reason); err != nil {
+		return err
+	}
+	return enc.string(attempt.PaymentID)
+}
+
+func readFraudAttemptBinary(snap *snapshot, dec *binaryDecoder) error {
+	var attempt FraudAttempt
+	var err error
+	if attempt.ID, err = dec.id(); err != nil {
+		return err
+	}
+	if attempt.Time, err = dec.time(); err != nil {
+		return err
+	}
+	if attempt.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	attempt.Amount = types.Money(amount)
+	category, err := dec.word("category")
+	if err != nil {
+		return err
+	}
+	attempt.Category = types.PaymentCategory(category)
+	decision, err := dec.word("decision")
+	if err != nil {
+		return err
+	}
+	attempt.Decision = Decision(decision)
+	if attempt.Rule, err = dec.word("rule"); err != nil {
+		return err
+	}
+	if attempt.Reason, err = dec.string(); err != nil {
+		return err
+	}
+	if attempt.PaymentID, err = dec.string(); err != nil {
+		return err
+	}
+
+	snap.attempts = append(snap.attempts, attempt)
+	return nil
+}
+
+func writeAccrualBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	state := snap.accruals[i]
+	if err := enc.varint(state.AccountID); err != nil {
+		return err
+	}
+	if err := enc.time(state.Through); err != nil {
+		return err
+	}
+	return enc.string(state.Accrued.String())
+}
+
+func readAccrualBinary(snap *snapshot, dec *binaryDecoder) error {
+	state := &accrual{}
+	var err error
+	if state.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	if state.Through, err = dec.time(); err != nil {
+		return err
+	}
+	accrued, err := dec.string()
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if state.Accrued, ok = new(big.Rat).SetString(accrued); !ok {
+		return fmt.Errorf("%w: invalid accrued interest %q", ErrInvalidBinary, accrued)
+	}
+
+	snap.accruals = append(snap.accruals, state)
+	return nil
+}
+
+func writeLimitBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	limit := snap.limits[i]
+	if err := enc.varint(limit.AccountID); err != nil {
+		return err
+	}
+	if err := enc.word("category", string(limit.Category)); err != nil {
+		return err
+	}
+	if err := enc.word("period", string(limit.Period)); err != nil {
+		return err
+	}
+	var rolling uint64
+	if limit.Rolling {
+		rolling = 1
+	}
+	if err := enc.uvarint(rolling); err != nil {
+		return err
+	}
+	return enc.varint(int64(limit.Amount))
+}
+
+func readLimitBinary(snap *snapshot, dec *binaryDecoder) error {
+	var limit Limit
+	var err error
+	if limit.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	category, err := dec.word("category")
+	if err != nil {
+		return err
+	}
+	limit.Category = types.PaymentCategory(category)
+	period, err := dec.word("period")
+	if err != nil {
+		return err
+	}
+	limit.Period = LimitPeriod(period)
+	rolling, err := dec.uvarint()
+	if err != nil {
+		return err
+	}
+	limit.Rolling = rolling != 0
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	limit.Amount = types.Money(amount)
+
+	snap.limits = append(snap.limits, limit)
+	return nil
+}
+
+func writeBudgetBinary(snap *snapshot, i int, enc *binaryEncoder) error {
+	budget := snap.budgets[i]
+	if err := enc.varint(budget.AccountID); err != nil {
+		return err
+	}
+	if err := enc.word("category", string(budget.Category)); err != nil {
+		return err
+	}
+	return enc.varint(int64(budget.Amount))
+}
+
+func readBudgetBinary(snap *snapshot, dec *binaryDecoder) error {
+	var budget Budget
+	var err error
+	if budget.AccountID, err = dec.varint(); err != nil {
+		return err
+	}
+	category, err := dec.word("category")
+	if err != nil {
+		return err
+	}
+	budget.Category = types.PaymentCategory(category)
+	amount, err := dec.varint()
+	if err != nil {
+		return err
+	}
+	budget.Amount = types.Money(amount)
+
+	snap.budgets = append(snap.budgets, budget)
+	return nil
+}
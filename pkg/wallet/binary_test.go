@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+func TestBinary_roundTrip(t *testing.T) {
+	updated := time.Date(2020, 11, 1, 10, 30, 0, 15, time.UTC)
+	snap := &snapshot{
+		accounts: []*types.Account{
+			{ID: 1, Phone: "+992901000876", Balance: -150_00, Bonus: 7_50, Updated: updated},
+			{ID: 1 << 40, Phone: "", Balance: 0},
+		},
+		payments: []*types.Payment{
+			{ID: "a869fe66-7265-461d-a2a8-6e3dd4061f5d", AccountID: 1, Amount: 200000, Category: "auto", Status: types.PaymentStatusInProgress, Updated: updated, FavoriteID: "daf9820c-0706-4480-932e-bc23c9875d52"},
+			{ID: "A869FE66-7265-461D-A2A8-6E3DD4061F5D", AccountID: 1, Amount: 1, Category: "auto", Status: types.PaymentStatusFail},
+			{ID: "1c2d3e4f", AccountID: 2, Amount: 50000, Category: "food", Status: "DONE"},
+		},
+		favorites: []*types.Favorite{
+			{ID: "daf9820c-0706-4480-932e-bc23c9875d52", AccountID: 1, Name: "My; Favorite|Payment\n", Amount: 200000, Category: "auto", Updated: updated},
+		},
+		entries: []*types.Entry{
+			{ID: "5e0c1a52-8d4b-4f0e-9c1d-2b6f3a7e9d10", AccountID: 1, Kind: types.EntryCashback, Amount: 7_50, PaymentID: "a869fe66-7265-461d-a2a8-6e3dd4061f5d", Note: "auto 5%", Created: updated},
+			{ID: "9b1f", AccountID: 1, Kind: types.EntryClawback, Amount: 1},
+		},
+	}
+
+	got := &snapshot{}
+	for _, sec := range sections {
+		var buf bytes.Buffer
+		if err := encodeSection(context.Background(), &buf, FormatBinary, sec, snap); err != nil {
+			t.Fatalf("encodeSection(%s): error = %v", sec.name, err)
+		}
+		if err := decodeSection(context.Background(), &buf, FormatBinary, sec, got, nil); err != nil {
+			t.Fatalf("decodeSection(%s): error = %v", sec.name, err)
+		}
+	}
+
+	if !reflect.DeepEqual(snap, got) {
+		t.Errorf("decodeSection(): want %v got %v", snap, got)
+	}
+}
+
+func TestBinary_damaged(t *testing.T) {
+	snap := &snapshot{payments: []*types.Payment{
+		{ID: uuid.New().String(), AccountID: 1, Amount: 100, Category: "auto", Status: types.PaymentStatusOk},
+		{ID: uuid.New().String(), AccountID: 1, Amount: 200, Category: "food", Status: types.PaymentStatusOk},
+	}}
+	payments := sections[1]
+
+	var buf bytes.Buffer
+	if err := encodeSection(context.Background(), &buf, FormatBinary, payments, snap); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "truncated", data: data[:len(data)-3], want: io.ErrUnexpectedEOF},
+		{name: "trailing data", data: append(append([]byte(nil), data...), 0), want: ErrInvalidBinary},
+		{name: "no header", data: []byte("payments"), want: ErrInvalidBinary},
+	}
+	for _, test := range tests {
+		err := decodeSection(context.Background(), bytes.NewReader(test.data), FormatBinary, payments, &snapshot{}, nil)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, test.want) {
+			t.Errorf("decodeSection(%s): must return *ParseError with %v, returned = %v", test.name, test.want, err)
+		}
+	}
+}
+
+//benchmarkSnapshot - снапшот с n платежами по 100 счетам
+func benchmarkSnapshot(n int) *snapshot {
+	categories := []types.PaymentCategory{"auto", "food", "mobile", "internet", "restaurant"}
+	snap := &snapshot{}
+	for i := 1; i <= 100; i++ {
+		snap.accounts = append(snap.accounts, &types.Account{ID: int64(i), Phone: types.Phone("+99290" + strconv.Itoa(1_000_000+i)), Balance: 1_000_000_00})
+	}
+	updated := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		snap.payments = append(snap.payments, &types.Payment{
+			ID:        uuid.New().String(),
+			AccountID: int64(i%100 + 1),
+			Amount:    types.Money(i%10_000 + 1),
+			Category:  categories[i%len(categories)],
+			Status:    types.PaymentStatusOk,
+			Updated:   updated.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return snap
+}
+
+func benchmarkEncode(b *testing.B, format Format) {
+	snap := benchmarkSnapshot(100_000)
+	payments := sections[1]
+	b.ResetTimer()
+
+	var size int
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := encodeSection(context.Background(), &buf, format, payments, snap); err != nil {
+			b.Fatal(err)
+		}
+		size = buf.Len()
+	}
+	b.ReportMetric(float64(size), "bytes")
+}
+
+func benchmarkDecode(b *testing.B, format Format) {
+	payments := sections[1]
+	var buf bytes.Buffer
+	if err := encodeSection(context.Background(), &buf, format, payments, benchmarkSnapshot(100_000)); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := decodeSection(context.Background(), bytes.NewReader(data), format, payments, &snapshot{}, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes")
+}
+
+func BenchmarkEncodePayments_dump(b *testing.B)   { benchmarkEncode(b, FormatDump) }
+func BenchmarkEncodePayments_json(b *testing.B)   { benchmarkEncode(b, FormatJSONLines) }
+func BenchmarkEncodePayments_binary(b *testing.B) { benchmarkEncode(b, FormatBinary) }
+func BenchmarkDecodePayments_dump(b *testing.B)   { benchmarkDecode(b, FormatDump) }
+func BenchmarkDecodePayments_json(b *testing.B)   { benchmarkDecode(b, FormatJSONLines) }
+func BenchmarkDecodePayments_binary(b *testing.B) { benchmarkDecode(b, FormatBinary) }
@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//BudgetThresholds - доли бюджета в процентах, при достижении которых отправляется BudgetAlert
+var BudgetThresholds = []int{80, 100}
+
+//Budget - месячный бюджет счёта на категорию платежей
+type Budget struct {
+	AccountID int64                 `json:"accountId"`
+	Category  types.PaymentCategory `json:"category"`
+	Amount    types.Money           `json:"amount"`
+}
+
+//BudgetStatus - расход по бюджету за календарный месяц
+type BudgetStatus struct {
+	Budget    Budget      `json:"budget"`
+	Month     time.Time   `json:"month"` // начало месяца, UTC
+	Spent     types.Money `json:"spent"`
+	Remaining types.Money `json:"remaining"` // отрицательный, если бюджет превышен
+	Percent   int         `json:"percent"`
+}
+
+//BudgetAlert - платёж довёл расход по бюджету до порога Threshold процентов
+type BudgetAlert struct {
+	Status    BudgetStatus
+	Threshold int
+	PaymentID string
+}
+
+func (BudgetAlert) Kind() EventKind { return EventBudgetAlert }
+
+//key возвращает бюджет без суммы: у счёта один бюджет на категорию
+func (b Budget) key() Budget {
+	b.Amount = 0
+	return b
+}
+
+//SetBudget задаёт месячный бюджет счёта на категорию, заменяя прежний
+func (s *Service) SetBudget(budget Budget) error {
+	if budget.Amount <= 0 {
+		return fmt.Errorf("%w: budget %d", ErrAmountMustBePositive, budget.Amount)
+	}
+	if _, err := s.FindAccountByID(budget.AccountID); err != nil {
+		return err
+	}
+
+	s.putBudget(budget)
+	return nil
+}
+
+//putBudget добавляет бюджет или заменяет бюджет счёта на ту же категорию
+func (s *Service) putBudget(budget Budget) {
+	for i, existing := range s.budgets {
+		if existing.key() == budget.key() {
+			s.budgets[i] = budget
+			return
+		}
+	}
+	s.budgets = append(s.budgets, budget)
+}
+
+//RemoveBudget удаляет бюджет счёта на категорию
+func (s *Service) RemoveBudget(accountID int64, category types.PaymentCategory) bool {
+	for i, existing := range s.budgets {
+		if existing.AccountID == accountID && existing.Category == category {
+			s.budgets = append(s.budgets[:i:i], s.budgets[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//BudgetReport возвращает расход по бюджетам счёта за месяц, в который попадает
+//month. Нулевой month - текущий месяц по часам сервиса
+func (s *Service) BudgetReport(accountID int64, month time.Time) ([]BudgetStatus, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+	if month.IsZero() {
+		month = s.now()
+	}
+
+	var report []BudgetStatus
+	for _, budget := range s.budgets {
+		if budget.AccountID == accountID {
+			report = append(report, s.budgetStatus(budget, month))
+		}
+	}
+	return report, nil
+}
+
+//budgetStatus считает расход по бюджету за месяц, в который попадает month
+func (s *Service) budgetStatus(budget Budget, month time.Time) BudgetStatus {
+	month = month.UTC()
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	spent := s.spent(budget.AccountID, budget.Category, start, start.AddDate(0, 1, 0))
+	return BudgetStatus{
+		Budget:    budget,
+		Month:     start,
+		Spent:     spent,
+		Remaining: budget.Amount - spent,
+		Percent:   int(spent * 100 / budget.Amount),
+	}
+}
+
+//checkBudgets отправляет BudgetAlert для каждого порога бюджета, который
+//пересёк платёж payment
+func (s *Service) checkBudgets(payment *types.Payment) {
+	for _, budget := range s.budgets {
+		if budget.AccountID != payment.AccountID || budget.Category != payment.Category {
+			continue
+		}
+
+		status := s.budgetStatus(budget, payment.Created)
+		before := status.Spent - payment.Amount
+		for _, threshold := range BudgetThresholds {
+			limit := budget.Amount * types.Money(threshold)
+			if before*100 < limit && status.Spent*100 >= limit {
+				s.emit(BudgetAlert{Status: status, Threshold: threshold, PaymentID: payment.ID})
+			}
+		}
+	}
+}
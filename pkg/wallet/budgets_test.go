@@ -0,0 +1,141 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestService_budgetAlerts(t *testing.T) {
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+
+	var alerts []BudgetAlert
+	s.Subscribe(func(ctx context.Context, event Event) {
+		alerts = append(alerts, event.(BudgetAlert))
+	}, EventBudgetAlert)
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetBudget(Budget{AccountID: account.ID, Category: "fun", Amount: 1_000_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	//700 - ниже порога, 850 - 80%, 1050 - 100%, дальше порогов нет
+	first, err := s.Pay(account.ID, 700_00, "fun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pay(account.ID, 500_00, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Pay(): want no alerts below 80%%, got %+v", alerts)
+		return
+	}
+	second, err := s.Repeat(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pay(account.ID, 100_00, "fun"); err != nil {
+		t.Fatal(err)
+	}
+
+	//платёж сразу за оба порога отправляет оба оповещения
+	if len(alerts) != 2 || alerts[0].Threshold != 80 || alerts[1].Threshold != 100 || alerts[0].PaymentID != second.ID {
+		t.Errorf("Repeat(): want 80 and 100 alerts for %v, got %+v", second.ID, alerts)
+		return
+	}
+	if alerts[1].Status.Spent != 1_400_00 || alerts[1].Status.Percent != 140 {
+		t.Errorf("BudgetAlert: want spent 140000 (140%%), got %+v", alerts[1].Status)
+	}
+
+	report, err := s.BudgetReport(account.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Spent != 1_500_00 || report[0].Remaining != -500_00 || !report[0].Month.Equal(time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("BudgetReport(): want spent 150000 in November, got %+v", report)
+	}
+
+	//в новом месяце расход считается заново
+	now = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	alerts = nil
+	if _, err := s.Pay(account.ID, 800_00, "fun"); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Threshold != 80 || alerts[0].Status.Spent != 800_00 {
+		t.Errorf("Pay() next month: want 80%% alert, got %+v", alerts)
+	}
+	past, err := s.BudgetReport(account.ID, time.Date(2020, 11, 30, 0, 0, 0, 0, time.UTC))
+	if err != nil || past[0].Spent != 1_500_00 {
+		t.Errorf("BudgetReport(November): want spent 150000, got %+v, %v", past, err)
+	}
+}
+
+func TestService_SetBudget(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SetBudget(Budget{AccountID: account.ID, Category: "fun", Amount: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetBudget(Budget{AccountID: account.ID, Category: "fun", Amount: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.budgets) != 1 || s.budgets[0].Amount != 200 {
+		t.Errorf("SetBudget(): want budget replaced, got %v", s.budgets)
+	}
+	if err := s.SetBudget(Budget{AccountID: account.ID, Category: "fun"}); !errors.Is(err, ErrAmountMustBePositive) {
+		t.Errorf("SetBudget(): want ErrAmountMustBePositive, got %v", err)
+	}
+	if err := s.SetBudget(Budget{AccountID: 42, Category: "fun", Amount: 1}); err != ErrAccountNotFound {
+		t.Errorf("SetBudget(): want ErrAccountNotFound, got %v", err)
+	}
+	if _, err := s.BudgetReport(42, time.Now()); err != ErrAccountNotFound {
+		t.Errorf("BudgetReport(): want ErrAccountNotFound, got %v", err)
+	}
+
+	if !s.RemoveBudget(account.ID, "fun") || len(s.budgets) != 0 {
+		t.Errorf("RemoveBudget(): want budget removed, got %v", s.budgets)
+	}
+}
+
+func TestService_budgets_persisted(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	budgets := []Budget{
+		{AccountID: account.ID, Category: "food", Amount: 3_000_00},
+		{AccountID: account.ID, Category: "fun; games", Amount: 500_00},
+	}
+	for _, budget := range budgets {
+		if err := s.SetBudget(budget); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range formats {
+		dir := t.TempDir()
+		if err := s.Export(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Export(%v): error = %v", format, err)
+		}
+		restored := newTestService()
+		if err := restored.Import(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Import(%v): error = %v", format, err)
+		}
+		if !reflect.DeepEqual(restored.budgets, budgets) {
+			t.Errorf("Import(%v): want budgets %v got %v", format, budgets, restored.budgets)
+		}
+	}
+}
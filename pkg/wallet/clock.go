@@ -0,0 +1,17 @@
+package wallet
+
+import "time"
+
+//SetClock задаёт источник текущего времени для меток Updated. По умолчанию time.Now
+func (s *Service) SetClock(now func() time.Time) {
+	s.clock = now
+}
+
+//now возвращает текущее время в UTC без монотонной составляющей, чтобы метки
+//совпадали после записи в выгрузку и чтения из неё
+func (s *Service) now() time.Time {
+	if s.clock == nil {
+		return time.Now().UTC().Round(0)
+	}
+	return s.clock().UTC().Round(0)
+}
@@ -0,0 +1,89 @@
+package wallet
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	traceIDKey
+)
+
+//WithActor возвращает копию ctx, в которой сохранён инициатор операции
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+//ActorFromContext возвращает инициатора операции или пустую строку
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+//WithTraceID возвращает копию ctx с идентификатором трассировки запроса
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+//TraceIDFromContext возвращает идентификатор трассировки или пустую строку
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey).(string)
+	return traceID
+}
+
+//Operation представляет название операции сервиса, передаваемое в хуки
+type Operation string
+
+//Операции сервиса
+const (
+	OpRegisterAccount Operation = "register_account"
+	OpDeposit         Operation = "deposit"
+	OpPay             Operation = "pay"
+	OpReject          Operation = "reject"
+	OpConfirm         Operation = "confirm"
+	OpRepeat          Operation = "repeat"
+	OpFavoritePayment Operation = "favorite_payment"
+	OpPayFromFavorite Operation = "pay_from_favorite"
+	OpAccrueInterest  Operation = "accrue_interest"
+	OpExport          Operation = "export"
+	OpImport          Operation = "import"
+	OpExportToFile    Operation = "export_to_file"
+	OpImportFromFile  Operation = "import_from_file"
+	OpExportTo        Operation = "export_to"
+	OpImportFrom      Operation = "import_from"
+)
+
+//Hook вызывается после завершения операции с контекстом запроса и её результатом
+type Hook func(ctx context.Context, op Operation, err error)
+
+//AddHook регистрирует хук, вызываемый после каждой операции с контекстом
+func (s *Service) AddHook(hook Hook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+//runHooks завершает операцию: пишет её изменения в аудит, рассылает события
+//и вызывает хуки. Возвращает err или, если операция удалась, ошибку записи
+//аудита: изменения уже применены, и события о них всё равно рассылаются
+func (s *Service) runHooks(ctx context.Context, op Operation, err error) error {
+	aerr := s.commitAudit(ctx, op, err)
+	s.publishEvents(ctx, err)
+	if err == nil {
+		err = aerr
+	}
+	for _, hook := range s.hooks {
+		hook(ctx, op, err)
+	}
+	return err
+}
+
+//ctxCheckInterval - через сколько записей циклы проверяют отмену контекста
+const ctxCheckInterval = 1024
+
+func checkContext(ctx context.Context, i int) error {
+	if i%ctxCheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
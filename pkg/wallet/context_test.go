@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+func TestService_PayContext_hookReceivesRequestValues(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+
+	account, _, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var gotActor, gotTrace string
+	var gotOp Operation
+	s.AddHook(func(ctx context.Context, op Operation, err error) {
+		gotActor = ActorFromContext(ctx)
+		gotTrace = TraceIDFromContext(ctx)
+		gotOp = op
+	})
+
+	ctx := WithTraceID(WithActor(context.Background(), "operator"), "trace-1")
+	_, err = s.PayContext(ctx, account.ID, 1_00, "auto")
+	if err != nil {
+		t.Errorf("PayContext(): error = %v", err)
+		return
+	}
+
+	if gotActor != "operator" || gotTrace != "trace-1" || gotOp != OpPay {
+		t.Errorf("PayContext(): hook got actor=%q trace=%q op=%q", gotActor, gotTrace, gotOp)
+		return
+	}
+}
+
+func TestService_PayContext_canceled(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+
+	account, _, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = s.PayContext(ctx, account.ID, 1_00, "auto")
+	if err != context.Canceled {
+		t.Errorf("PayContext(): must return context.Canceled, returned = %v", err)
+		return
+	}
+
+	if len(s.payments) != len(defaultTestAccount.payments) {
+		t.Errorf("PayContext(): payment created with canceled context")
+		return
+	}
+}
+
+func TestService_ExportImportContext_canceled(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+	s.addAccount(defaultTestAccount)
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = s.ExportContext(ctx, dir)
+	if err != context.Canceled {
+		t.Errorf("ExportContext(): must return context.Canceled, returned = %v", err)
+		return
+	}
+
+	err = s.ImportContext(ctx, dir)
+	if err != context.Canceled {
+		t.Errorf("ImportContext(): must return context.Canceled, returned = %v", err)
+		return
+	}
+}
+
+func TestService_SumPaymentsContext_canceled(t *testing.T) {
+	s := newTestService()
+	for i := 0; i < 10_000; i++ {
+		s.payments = append(s.payments, &types.Payment{
+			ID:     uuid.New().String(),
+			Amount: types.Money(100),
+		})
+	}
+
+	got, err := s.SumPaymentsContext(context.Background(), 3)
+	if err != nil || got != types.Money(1_000_000) {
+		t.Errorf("SumPaymentsContext(): want: %v got: %v, error = %v", types.Money(1_000_000), got, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = s.SumPaymentsContext(ctx, 3)
+	if err != context.Canceled {
+		t.Errorf("SumPaymentsContext(): must return context.Canceled, returned = %v", err)
+		return
+	}
+
+	//отменённый подсчёт не отдаёт ни одной части: проверка контекста идёт до первого платежа
+	var parts []types.Progress
+	for progress := range s.SumPaymentsWithProgressContext(ctx) {
+		parts = append(parts, progress)
+	}
+	if len(parts) != 0 {
+		t.Errorf("SumPaymentsWithProgressContext(): want no progress after cancel, got %v", parts)
+	}
+}
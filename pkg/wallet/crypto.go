@@ -0,0 +1,455 @@
+package wallet
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var ErrKeyRequired = errors.New("file is encrypted, key provider required")
+var ErrKeyNotFound = errors.New("encryption key not found")
+var ErrDecrypt = errors.New("can't decrypt file: wrong key or corrupted data")
+
+//KeyProvider выдаёт ключи AES (16, 24 или 32 байта) для шифрования выгрузок
+type KeyProvider interface {
+	//CurrentKey возвращает ключ, которым шифруются новые файлы, и его идентификатор
+	CurrentKey() (id string, key []byte, err error)
+	//Key возвращает ключ по идентификатору из заголовка зашифрованного файла
+	Key(id string) ([]byte, error)
+}
+
+//StaticKeys - KeyProvider с ключами в памяти. Current - идентификатор ключа для новых файлов
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+//LoadKeys читает ключи из JSON-файла вида {"current": "2020-12", "keys": {"2020-11": "<base64>", "2020-12": "<base64>"}}
+func LoadKeys(path string) (StaticKeys, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return StaticKeys{}, err
+	}
+
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string][]byte `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return StaticKeys{}, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := StaticKeys{Current: file.Current, Keys: file.Keys}
+	if _, _, err := keys.CurrentKey(); err != nil {
+		return StaticKeys{}, fmt.Errorf("%s: current key: %w", path, err)
+	}
+	for id, key := range keys.Keys {
+		if _, err := newGCM(key); err != nil {
+			return StaticKeys{}, fmt.Errorf("%s: key %q: %w", path, id, err)
+		}
+	}
+	return keys, nil
+}
+
+//WithEncryption шифрует файлы Export и ExportToFile ключом keys.CurrentKey и
+//позволяет Import и ImportFromFile читать файлы, зашифрованные любым ключом keys
+func WithEncryption(keys KeyProvider) Option {
+	return func(o *options) {
+		o.keys = keys
+	}
+}
+
+//Зашифрованный файл: magic, длина и идентификатор ключа, префикс nonce и
+//блоки AES-GCM. Каждый блок - uint32 длины шифротекста, старший бит которого
+//отмечает последний блок, и сам шифротекст. Nonce блока - префикс и номер блока,
+//дополнительные данные - заголовок файла и признак последнего блока, поэтому
+//перестановка, подмена и отрезанный хвост обнаруживаются при чтении
+const (
+	encryptedMagic   = "WALLETENC1"
+	noncePrefixSize  = 8
+	encryptChunkSize = 64 * 1024
+	finalChunkFlag   = 1 << 31
+)
+
+//isEncrypted сообщает, начинается ли r с заголовка зашифрованного файла
+func isEncrypted(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(encryptedMagic))
+	return string(magic) == encryptedMagic
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte
+	chunk  uint32
+	closed bool
+}
+
+//newEncryptWriter пишет в w заголовок и возвращает writer, шифрующий данные
+//блоками. Close записывает последний блок, но не закрывает w
+func newEncryptWriter(w io.Writer, keys KeyProvider) (io.WriteCloser, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("key id %q is too long", id)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(encryptedMagic), byte(len(id)))
+	header = append(header, id...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, encryptChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		//полный блок пишется, только когда пришли следующие данные,
+		//чтобы последним всегда был блок из Close
+		if len(e.buf) == cap(e.buf) {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.chunk), e.buf, chunkAD(e.header, final))
+	length := uint32(len(sealed))
+	if final {
+		length |= finalChunkFlag
+	}
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], length)
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.chunk++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	chunk  uint32
+	plain  []byte
+	done   bool
+}
+
+//newDecryptReader читает заголовок зашифрованного файла из r и возвращает
+//reader расшифрованных данных. Ключ берётся из keys по идентификатору заголовка
+func newDecryptReader(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	if keys == nil {
+		return nil, ErrKeyRequired
+	}
+
+	header := make([]byte, len(encryptedMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, errors.New("not an encrypted file")
+	}
+
+	rest := make([]byte, int(header[len(encryptedMagic)])+noncePrefixSize)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	header = append(header, rest...)
+	id := string(rest[:len(rest)-noncePrefixSize])
+
+	key, err := keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		header: header,
+		prefix: rest[len(rest)-noncePrefixSize:],
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		if err == io.EOF {
+			//файл закончился до последнего блока
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	length := binary.BigEndian.Uint32(size[:])
+	final := length&finalChunkFlag != 0
+	length &^= finalChunkFlag
+	if length > encryptChunkSize+uint32(d.aead.Overhead()) {
+		return ErrDecrypt
+	}
+
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.prefix, d.chunk), sealed, chunkAD(d.header, final))
+	if err != nil {
+		return ErrDecrypt
+	}
+
+	d.chunk++
+	d.plain = plain
+	d.done = final
+	return nil
+}
+
+func chunkNonce(prefix []byte, chunk uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], chunk)
+	return nonce
+}
+
+func chunkAD(header []byte, final bool) []byte {
+	ad := bytes.NewBuffer(make([]byte, 0, len(header)+1))
+	ad.Write(header)
+	if final {
+		ad.WriteByte(1)
+	} else {
+		ad.WriteByte(0)
+	}
+	return ad.Bytes()
+}
+
+//encodeTo вызывает write с w, зашифрованным ключом keys, если они заданы
+func encodeTo(w io.Writer, keys KeyProvider, write func(w io.Writer) error) error {
+	if keys == nil {
+		return write(w)
+	}
+
+	encrypted, err := newEncryptWriter(w, keys)
+	if err != nil {
+		return err
+	}
+	if err := write(encrypted); err != nil {
+		return err
+	}
+	return encrypted.Close()
+}
+
+//decodeFrom возвращает содержимое r, расшифрованное при необходимости
+func decodeFrom(r io.Reader, keys KeyProvider) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	if !isEncrypted(buffered) {
+		return buffered, nil
+	}
+	return newDecryptReader(buffered, keys)
+}
+
+//encryptedKeyID возвращает идентификатор ключа из заголовка зашифрованного файла
+func encryptedKeyID(r *bufio.Reader) (string, bool) {
+	if !isEncrypted(r) {
+		return "", false
+	}
+	header, err := r.Peek(len(encryptedMagic) + 1)
+	if err != nil {
+		return "", false
+	}
+	idLen := int(header[len(encryptedMagic)])
+	header, err = r.Peek(len(encryptedMagic) + 1 + idLen)
+	if err != nil {
+		return "", false
+	}
+	return string(header[len(encryptedMagic)+1:]), true
+}
+
+//RotateKeys перешифровывает текущим ключом keys все зашифрованные файлы в dir,
+//которые зашифрованы другим ключом, и обновляет их контрольные суммы в
+//манифестах. Каждый файл заменяется атомарно через временный файл
+func RotateKeys(dir string, keys KeyProvider) error {
+	currentID, _, err := keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	sums := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		sum, rotated, err := rotateFile(path, currentID, keys)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if rotated {
+			sums[entry.Name()] = sum
+		}
+	}
+
+	if len(sums) == 0 {
+		return nil
+	}
+	for _, format := range formats {
+		manifest, err := readManifest(dir, format)
+		if err != nil {
+			return err
+		}
+		if manifest == nil {
+			continue
+		}
+		for i, file := range manifest.Files {
+			if sum, ok := sums[file.Name]; ok {
+				manifest.Files[i].SHA256 = sum
+			}
+		}
+		if err := writeManifest(dir, format, manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rotateFile(path string, currentID string, keys KeyProvider) (sum string, rotated bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	id, encrypted := encryptedKeyID(buffered)
+	if !encrypted || id == currentID {
+		return "", false, nil
+	}
+
+	plain, err := newDecryptReader(buffered, keys)
+	if err != nil {
+		return "", false, err
+	}
+
+	tmp := path + ".rotate"
+	sum, err = writeFile(tmp, func(w io.Writer) error {
+		return encodeTo(w, keys, func(w io.Writer) error {
+			_, err := io.Copy(w, plain)
+			return err
+		})
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return "", false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", false, err
+	}
+	return sum, true, nil
+}
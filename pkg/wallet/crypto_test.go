@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKeys = StaticKeys{
+	Current: "2020-11",
+	Keys: map[string][]byte{
+		"2020-11": bytes.Repeat([]byte{1}, 32),
+		"2020-12": bytes.Repeat([]byte{2}, 32),
+	},
+}
+
+func TestEncryptWriter_roundTrip(t *testing.T) {
+	for _, size := range []int{0, 10, encryptChunkSize, 3*encryptChunkSize + 17} {
+		plain := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+
+		var encrypted bytes.Buffer
+		err := encodeTo(&encrypted, testKeys, func(w io.Writer) error {
+			_, err := w.Write(plain)
+			return err
+		})
+		if err != nil {
+			t.Errorf("encodeTo(%d): error = %v", size, err)
+			continue
+		}
+
+		reader, err := decodeFrom(bytes.NewReader(encrypted.Bytes()), testKeys)
+		if err != nil {
+			t.Errorf("decodeFrom(%d): error = %v", size, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(reader)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("decodeFrom(%d): content differs, error = %v", size, err)
+			continue
+		}
+
+		//отрезанный последний блок обнаруживается
+		truncated := encrypted.Bytes()[:encrypted.Len()-1]
+		reader, err = decodeFrom(bytes.NewReader(truncated), testKeys)
+		if err == nil {
+			_, err = ioutil.ReadAll(reader)
+		}
+		if err == nil {
+			t.Errorf("decodeFrom(%d): truncated file must fail", size)
+		}
+	}
+}
+
+func TestService_Export_encrypted(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := s.Export(dir, WithEncryption(testKeys)); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "accounts.dump"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), string(defaultTestAccount.phone)) {
+		t.Errorf("Export(): phone is written in plain text")
+		return
+	}
+
+	if err := newTestService().Import(dir); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Import(): must return ErrKeyRequired, returned = %v", err)
+		return
+	}
+
+	//после ротации файлы читаются только новым ключом
+	rotated := StaticKeys{Current: "2020-12", Keys: testKeys.Keys}
+	if err := RotateKeys(dir, rotated); err != nil {
+		t.Errorf("RotateKeys(): error = %v", err)
+		return
+	}
+
+	onlyNew := StaticKeys{Current: "2020-12", Keys: map[string][]byte{"2020-12": testKeys.Keys["2020-12"]}}
+	imported := newTestService()
+	if err := imported.Import(dir, WithEncryption(onlyNew)); err != nil {
+		t.Errorf("Import() after RotateKeys(): error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(s.snapshot(), imported.snapshot()) {
+		t.Errorf("Import(): want %v got %v", s.snapshot(), imported.snapshot())
+		return
+	}
+}
+
+func TestService_ExportToFile_encrypted(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+	s.SetClock(func() time.Time { return time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC) })
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "accounts.txt")
+	if err := s.ExportToFile(path, WithEncryption(testKeys)); err != nil {
+		t.Errorf("ExportToFile(): error = %v", err)
+		return
+	}
+
+	imported := newTestService()
+	imported.SetClock(s.clock)
+	if err := imported.ImportFromFile(path, WithEncryption(testKeys)); err != nil {
+		t.Errorf("ImportFromFile(): error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(s.accounts, imported.accounts) {
+		t.Errorf("ImportFromFile(): want %v got %v", s.accounts, imported.accounts)
+		return
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data, err := json.Marshal(map[string]interface{}{"current": testKeys.Current, "keys": testKeys.Keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, testKeys) {
+		t.Errorf("LoadKeys(): want %+v, got %+v", testKeys, keys)
+	}
+
+	invalid := []struct {
+		data string
+		want error
+	}{
+		{`{"current": "2021-01", "keys": {"2020-11": "AQEBAQEBAQEBAQEBAQEBAQ=="}}`, ErrKeyNotFound},
+		{`{"current": "short", "keys": {"short": "AQID"}}`, aes.KeySizeError(3)},
+	}
+	for _, tt := range invalid {
+		if err := ioutil.WriteFile(path, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeys(path); !errors.Is(err, tt.want) {
+			t.Errorf("LoadKeys(%s): want %v, got %v", tt.data, tt.want, err)
+		}
+	}
+}
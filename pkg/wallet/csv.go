@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//Locale описывает запись денежных сумм в выписках
+type Locale struct {
+	DecimalSeparator string // разделитель дробной части
+	GroupSeparator   string // разделитель разрядов, может быть пустым
+	Decimals         int    // число минимальных единиц в дробной части: 2 для дирамов и центов
+}
+
+//Предопределённые локали
+var (
+	LocaleEN = Locale{DecimalSeparator: ".", GroupSeparator: ",", Decimals: 2}
+	LocaleRU = Locale{DecimalSeparator: ",", GroupSeparator: " ", Decimals: 2}
+)
+
+//FormatMoney записывает сумму в минимальных единицах по правилам локали: 123456 -> 1,234.56
+func (l Locale) FormatMoney(amount types.Money) string {
+	sign := ""
+	value := uint64(amount)
+	if amount < 0 {
+		sign = "-"
+		value = uint64(-amount)
+	}
+
+	digits := strconv.FormatUint(value, 10)
+	if len(digits) <= l.Decimals {
+		digits = strings.Repeat("0", l.Decimals-len(digits)+1) + digits
+	}
+	whole := digits[:len(digits)-l.Decimals]
+	fraction := digits[len(digits)-l.Decimals:]
+
+	if l.GroupSeparator != "" {
+		var grouped strings.Builder
+		for i, digit := range whole {
+			if i > 0 && (len(whole)-i)%3 == 0 {
+				grouped.WriteString(l.GroupSeparator)
+			}
+			grouped.WriteRune(digit)
+		}
+		whole = grouped.String()
+	}
+
+	if fraction == "" {
+		return sign + whole
+	}
+	return sign + whole + l.DecimalSeparator + fraction
+}
+
+//CSVOptions настраивает выписки в CSV. Нулевое значение - запятая и LocaleEN
+type CSVOptions struct {
+	Comma  rune
+	Locale Locale
+}
+
+func (o CSVOptions) withDefaults() CSVOptions {
+	if o.Comma == 0 {
+		o.Comma = ','
+	}
+	if o.Locale.DecimalSeparator == "" {
+		o.Locale = LocaleEN
+	}
+	return o
+}
+
+//ExportStatementCSV пишет в w выписку по счёту за всё время: входящий остаток,
+//изменения баланса в порядке Statement с остатком после каждого и исходящий
+//остаток, равный текущему балансу. Платёж, комиссия, её возврат и отмена платежа
+//идут отдельными строками со статусом платежа; изменения, не попадающие в
+//Statement, учтены во входящем остатке
+func (s *Service) ExportStatementCSV(w io.Writer, accountID int64, opts CSVOptions) error {
+	return s.ExportStatementCSVContext(context.Background(), w, accountID, opts)
+}
+
+func (s *Service) ExportStatementCSVContext(ctx context.Context, w io.Writer, accountID int64, opts CSVOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	opts = opts.withDefaults()
+	money := opts.Locale.FormatMoney
+
+	history := s.balanceHistory(accountID)
+	opening := account.Balance
+	for _, line := range history {
+		opening -= line.Amount
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.Comma
+
+	rows := [][]string{
+		{"operation", "payment_id", "category", "status", "amount", "balance"},
+		{"opening balance", "", "", "", "", money(opening)},
+	}
+	balance := opening
+	for i, line := range history {
+		if err := checkContext(ctx, i); err != nil {
+			return err
+		}
+		balance += line.Amount
+
+		var status types.PaymentStatus
+		if line.PaymentID != "" {
+			if payment, err := s.FindPaymentByID(line.PaymentID); err == nil {
+				status = payment.Status
+			}
+		}
+		rows = append(rows, []string{
+			line.Kind,
+			line.PaymentID,
+			string(line.Category),
+			string(status),
+			money(line.Amount),
+			money(balance),
+		})
+	}
+	rows = append(rows, []string{"closing balance", "", "", "", "", money(balance)})
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+//ExportStatementsCSV пишет в dir файл statement-<id>.csv для каждого счёта
+func (s *Service) ExportStatementsCSV(dir string, opts CSVOptions) error {
+	for _, account := range s.accounts {
+		path := filepath.Join(dir, "statement-"+strconv.FormatInt(account.ID, 10)+".csv")
+		_, err := writeFile(path, func(w io.Writer) error {
+			return s.ExportStatementCSV(w, account.ID, opts)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package wallet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestLocale_FormatMoney(t *testing.T) {
+	tests := []struct {
+		locale Locale
+		amount types.Money
+		want   string
+	}{
+		{LocaleEN, 123_456_78, "123,456.78"},
+		{LocaleEN, -1_000_00, "-1,000.00"},
+		{LocaleEN, 5, "0.05"},
+		{LocaleRU, 1_234_567_89, "1 234 567,89"},
+		{Locale{DecimalSeparator: ".", Decimals: 0}, 1234, "1234"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.locale.FormatMoney(tt.amount); got != tt.want {
+			t.Errorf("FormatMoney(%d): want %q got %q", tt.amount, tt.want, got)
+		}
+	}
+}
+
+func TestService_ExportStatementCSV_success(t *testing.T) {
+	//создаём сервис, каждая операция - на минуту позже предыдущей
+	s := newTestService()
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	s.SetClock(func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	})
+
+	account, payments, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := s.SetFeeSchedule(Fee{Category: "fun", Fixed: 10_00}); err != nil {
+		t.Error(err)
+		return
+	}
+	rejected, err := s.Pay(account.ID, 500_00, "fun")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := s.Reject(rejected.ID); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = s.ExportStatementCSV(&buf, account.ID, CSVOptions{Comma: ';', Locale: LocaleRU})
+	if err != nil {
+		t.Errorf("ExportStatementCSV(): error = %v", err)
+		return
+	}
+
+	want := strings.Join([]string{
+		"operation;payment_id;category;status;amount;balance",
+		"opening balance;;;;;0,00",
+		"deposit;;;;4 000,00;4 000,00",
+		"payment;" + payments[0].ID + ";auto;INPROGRESS;-4 000,00;0,00",
+		"deposit;;;;1 000,00;1 000,00",
+		"payment;" + rejected.ID + ";fun;FAIL;-500,00;500,00",
+		"fee;" + rejected.ID + ";fun;FAIL;-10,00;490,00",
+		"refund;" + rejected.ID + ";fun;FAIL;500,00;990,00",
+		"fee_refund;" + rejected.ID + ";fun;FAIL;10,00;1 000,00",
+		"closing balance;;;;;1 000,00",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("ExportStatementCSV(): want\n%s\ngot\n%s", want, buf.String())
+		return
+	}
+
+	if err := s.ExportStatementCSV(&buf, account.ID+1, CSVOptions{}); err != ErrAccountNotFound {
+		t.Errorf("ExportStatementCSV(): must return ErrAccountNotFound, returned = %v", err)
+		return
+	}
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import "strings"
+
+//Поля текстовых выгрузок экранируются обратной косой чертой: "\;", "\|", "\\",
+//а переводы строк - "\n" и "\r". Неизвестные последовательности читаются как
+//есть, поэтому старые файлы без экранирования читаются так же, как раньше
+const escapedChars = "\\;|\n\r"
+
+//escapeField экранирует разделители, обратную косую черту и переводы строк в поле
+func escapeField(field string) string {
+	if !strings.ContainsAny(field, escapedChars) {
+		return field
+	}
+
+	var b strings.Builder
+	b.Grow(len(field) + 4)
+	for i := 0; i < len(field); i++ {
+		switch c := field[i]; c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\\', ';', '|':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+//joinEscaped экранирует поля и соединяет их через sep
+func joinEscaped(fields []string, sep string) string {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		escaped[i] = escapeField(field)
+	}
+	return strings.Join(escaped, sep)
+}
+
+//splitEscaped делит text по неэкранированным sep и снимает экранирование с полей
+func splitEscaped(text string, sep byte) []string {
+	if strings.IndexByte(text, '\\') < 0 {
+		return strings.Split(text, string(sep))
+	}
+
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			i++
+			switch next := text[i]; next {
+			case 'n':
+				field.WriteByte('\n')
+			case 'r':
+				field.WriteByte('\r')
+			case '\\', ';', '|':
+				field.WriteByte(next)
+			default:
+				field.WriteByte(c)
+				field.WriteByte(next)
+			}
+		case c == sep:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return append(fields, field.String())
+}
+
+//indexUnescaped возвращает индекс первого неэкранированного sep в data или -1
+func indexUnescaped(data []byte, sep byte) int {
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case sep:
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,117 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestSplitEscaped(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "1;+992901000876;0;", want: []string{"1", "+992901000876", "0", ""}},
+		{text: `Car\; monthly;a\|b`, want: []string{"Car; monthly", "a|b"}},
+		{text: `C:\\new\nline;x`, want: []string{`C:\new` + "\nline", "x"}},
+		//неизвестные последовательности и "\" в конце остаются как есть
+		{text: `a\tb;c\`, want: []string{`a\tb`, `c\`}},
+	}
+
+	for _, test := range tests {
+		got := splitEscaped(test.text, ';')
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitEscaped(%q): want %q got %q", test.text, test.want, got)
+		}
+	}
+
+	fields := []string{"Car; monthly", "a|b", `back\slash`, "multi\r\nline", ""}
+	if got := splitEscaped(joinEscaped(fields, ";"), ';'); !reflect.DeepEqual(got, fields) {
+		t.Errorf("splitEscaped(joinEscaped()): want %q got %q", fields, got)
+	}
+}
+
+func TestService_Export_separatorsInFields(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	payment, err := s.Pay(account.ID, 100_00, "car|fuel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FavoritePayment(payment.ID, "Car; monthly\nplan"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+	imported := newTestService()
+	if err := imported.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(s.snapshot(), imported.snapshot()) {
+		t.Errorf("Import(): want %v got %v", s.snapshot(), imported.snapshot())
+		return
+	}
+
+	//ExportToFile экранирует и "|" между записями
+	account.Phone = `+992|901;000\876`
+	path := filepath.Join(dir, "accounts.txt")
+	if err := s.ExportToFile(path); err != nil {
+		t.Errorf("ExportToFile(): error = %v", err)
+		return
+	}
+	fromFile := newTestService()
+	if err := fromFile.ImportFromFile(path); err != nil {
+		t.Errorf("ImportFromFile(): error = %v", err)
+		return
+	}
+	if len(fromFile.accounts) != 1 || fromFile.accounts[0].Phone != account.Phone {
+		t.Errorf("ImportFromFile(): want phone %q, got %v", account.Phone, fromFile.accounts)
+		return
+	}
+}
+
+func TestService_Import_unescapedVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//до v4 "\" в полях не экранировалась
+	content := "#wallet-dump favorites 3\n" +
+		`daf9820c-0706-4480-932e-bc23c9875d52;1;C:\new\;200000;auto;0` + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "favorites.dump"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService()
+	if err := s.Import(dir); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	want := &types.Favorite{ID: "daf9820c-0706-4480-932e-bc23c9875d52", AccountID: 1, Name: `C:\new\`, Amount: 200000, Category: "auto"}
+	if len(s.favorites) != 1 || !reflect.DeepEqual(s.favorites[0], want) {
+		t.Errorf("Import(): want %v got %v", want, s.favorites)
+		return
+	}
+}
@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"context"
+	"log"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//EventKind - тип события сервиса
+type EventKind string
+
+//Типы событий сервиса
+const (
+	EventAccountRegistered EventKind = "account_registered"
+	EventDeposited         EventKind = "deposited"
+	EventPaymentCreated    EventKind = "payment_created"
+	EventPaymentRejected   EventKind = "payment_rejected"
+	EventPaymentConfirmed  EventKind = "payment_confirmed"
+	EventFavoriteCreated   EventKind = "favorite_created"
+	EventBudgetAlert       EventKind = "budget_alert"
+)
+
+//Event - событие сервиса. Конкретный тип события определяется по Kind или
+//переключателем типов; записи в событиях - копии, их изменение не влияет на сервис
+type Event interface {
+	Kind() EventKind
+}
+
+//AccountRegistered - зарегистрирован новый счёт
+type AccountRegistered struct {
+	Account types.Account
+}
+
+//Deposited - счёт пополнен на Amount
+type Deposited struct {
+	Account types.Account
+	Amount  types.Money
+}
+
+//PaymentCreated - создан платёж, в том числе повтором или из избранного
+type PaymentCreated struct {
+	Payment types.Payment
+}
+
+//PaymentRejected - платёж отменён и деньги возвращены на счёт
+type PaymentRejected struct {
+	Payment types.Payment
+}
+
+//PaymentConfirmed - платёж проведён и получил статус OK
+type PaymentConfirmed struct {
+	Payment types.Payment
+}
+
+//FavoriteCreated - платёж добавлен в избранное
+type FavoriteCreated struct {
+	Favorite types.Favorite
+}
+
+func (AccountRegistered) Kind() EventKind { return EventAccountRegistered }
+func (Deposited) Kind() EventKind         { return EventDeposited }
+func (PaymentCreated) Kind() EventKind    { return EventPaymentCreated }
+func (PaymentRejected) Kind() EventKind   { return EventPaymentRejected }
+func (PaymentConfirmed) Kind() EventKind  { return EventPaymentConfirmed }
+func (FavoriteCreated) Kind() EventKind   { return EventFavoriteCreated }
+
+//EventHandler обрабатывает событие с контекстом операции, которая его вызвала
+type EventHandler func(ctx context.Context, event Event)
+
+type subscription struct {
+	handler EventHandler
+	kinds   []EventKind
+}
+
+func (sub *subscription) wants(kind EventKind) bool {
+	if len(sub.kinds) == 0 {
+		return true
+	}
+	for _, k := range sub.kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+//Subscribe регистрирует обработчик событий kinds, без kinds - всех событий.
+//Обработчик вызывается синхронно после успешного завершения операции; паника
+//в обработчике записывается в лог и не влияет на сервис и другие обработчики.
+//Возвращённая функция отменяет подписку
+func (s *Service) Subscribe(handler EventHandler, kinds ...EventKind) (unsubscribe func()) {
+	sub := &subscription{handler: handler, kinds: kinds}
+	s.subscriptions = append(s.subscriptions, sub)
+
+	return func() {
+		for i, other := range s.subscriptions {
+			if other == sub {
+				s.subscriptions = append(s.subscriptions[:i:i], s.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+//SubscribeChan доставляет события kinds в канал с буфером size. Сервис не
+//ждёт читателя: если буфер заполнен, событие отбрасывается с записью в лог.
+//Возвращённая функция отменяет подписку и закрывает канал
+func (s *Service) SubscribeChan(size int, kinds ...EventKind) (events <-chan Event, unsubscribe func()) {
+	ch := make(chan Event, size)
+	cancel := s.Subscribe(func(ctx context.Context, event Event) {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("event %s dropped: channel buffer is full", event.Kind())
+		}
+	}, kinds...)
+
+	closed := false
+	return ch, func() {
+		if closed {
+			return
+		}
+		closed = true
+		cancel()
+		close(ch)
+	}
+}
+
+//emit запоминает событие до завершения операции
+func (s *Service) emit(event Event) {
+	if len(s.subscriptions) == 0 {
+		return
+	}
+	s.events = append(s.events, event)
+}
+
+//publishEvents доставляет события успешной операции подписчикам
+func (s *Service) publishEvents(ctx context.Context, err error) {
+	events := s.events
+	s.events = nil
+	if err != nil {
+		return
+	}
+
+	//обработчик может отменить подписку, поэтому перебирается копия
+	subscriptions := append([]*subscription(nil), s.subscriptions...)
+	for _, event := range events {
+		for _, sub := range subscriptions {
+			if sub.wants(event.Kind()) {
+				deliver(ctx, sub.handler, event)
+			}
+		}
+	}
+}
+
+//deliver вызывает обработчик, перехватывая его панику
+func deliver(ctx context.Context, handler EventHandler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("event %s handler panicked: %v", event.Kind(), r)
+		}
+	}()
+	handler(ctx, event)
+}
@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestService_Subscribe(t *testing.T) {
+	s := newTestService()
+
+	var kinds []EventKind
+	var actors []string
+	s.Subscribe(func(ctx context.Context, event Event) {
+		kinds = append(kinds, event.Kind())
+		actors = append(actors, ActorFromContext(ctx))
+	})
+	var rejected []PaymentRejected
+	s.Subscribe(func(ctx context.Context, event Event) {
+		rejected = append(rejected, event.(PaymentRejected))
+	}, EventPaymentRejected)
+	//паника одного обработчика не мешает остальным и не ломает операцию
+	s.Subscribe(func(ctx context.Context, event Event) {
+		panic("handler failed")
+	}, EventDeposited)
+
+	ctx := WithActor(context.Background(), "operator")
+	account, err := s.RegisterAccountContext(ctx, "+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DepositContext(ctx, account.ID, 1_000_00); err != nil {
+		t.Errorf("Deposit(): error = %v", err)
+		return
+	}
+	if err := s.DepositContext(ctx, account.ID, -1); err != ErrAmountMustBePositive {
+		t.Fatalf("Deposit(): want ErrAmountMustBePositive, got %v", err)
+	}
+	payment, err := s.PayContext(ctx, account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FavoritePaymentContext(ctx, payment.ID, "Car"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RepeatContext(ctx, payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RejectContext(ctx, payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []EventKind{
+		EventAccountRegistered,
+		EventDeposited,
+		EventPaymentCreated,
+		EventFavoriteCreated,
+		EventPaymentCreated,
+		EventPaymentRejected,
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("Subscribe(): want events %v got %v", want, kinds)
+	}
+	for _, actor := range actors {
+		if actor != "operator" {
+			t.Errorf("Subscribe(): want actor operator, got %q", actor)
+		}
+	}
+	if len(rejected) != 1 || rejected[0].Payment != *payment {
+		t.Errorf("Subscribe(): want rejected %v, got %v", *payment, rejected)
+	}
+}
+
+func TestService_SubscribeChan(t *testing.T) {
+	s := newTestService()
+	events, unsubscribe := s.SubscribeChan(1, EventAccountRegistered)
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := *account
+	//буфер заполнен, второе событие отбрасывается
+	if _, err := s.RegisterAccount("+992901000877"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 100_00); err != nil {
+		t.Fatal(err)
+	}
+
+	event := <-events
+	//в событии копия счёта на момент регистрации
+	if event != (AccountRegistered{Account: registered}) {
+		t.Errorf("SubscribeChan(): want %v, got %v", AccountRegistered{Account: registered}, event)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, err := s.RegisterAccount("+992901000878"); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := <-events; ok {
+		t.Errorf("SubscribeChan(): want closed channel, got %v", event)
+	}
+	if len(s.subscriptions) != 0 {
+		t.Errorf("unsubscribe(): want no subscriptions, got %v", len(s.subscriptions))
+	}
+}
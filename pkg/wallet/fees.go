@@ -0,0 +1,228 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidFee = errors.New("invalid fee")
+
+//Fee - тариф комиссии за платёж: фиксированная часть плюс доля суммы в сотых
+//долях процента (150 - 1.5%), ограниченная снизу Min и сверху Max. Тариф
+//действует для платежей категории Category на сумму от From до From следующего
+//тарифа той же категории; тарифы с пустой категорией применяются к категориям
+//без своих тарифов
+type Fee struct {
+	Category types.PaymentCategory `json:"category,omitempty"`
+	From     types.Money           `json:"from,omitempty"`
+	Fixed    types.Money           `json:"fixed,omitempty"`
+	Rate     int                   `json:"rate,omitempty"`
+	Min      types.Money           `json:"min,omitempty"`
+	Max      types.Money           `json:"max,omitempty"` // 0 - без ограничения
+}
+
+//charge считает комиссию за платёж amount. Произведение amount*Rate может не
+//поместиться в int64, поэтому доля считается в big.Int: она не больше amount
+func (f Fee) charge(amount types.Money) types.Money {
+	share := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(int64(f.Rate)))
+	share.Quo(share, big.NewInt(10_000))
+	fee := f.Fixed + types.Money(share.Int64())
+	if fee < f.Fixed {
+		//переполнение при сложении с фиксированной частью
+		fee = types.Money(math.MaxInt64)
+	}
+	if fee < f.Min {
+		fee = f.Min
+	}
+	if f.Max > 0 && fee > f.Max {
+		fee = f.Max
+	}
+	return fee
+}
+
+func (f Fee) validate() error {
+	if f.From < 0 || f.Fixed < 0 || f.Min < 0 || f.Max < 0 {
+		return fmt.Errorf("%w: negative amount in %+v", ErrInvalidFee, f)
+	}
+	if f.Rate < 0 || f.Rate > 10_000 {
+		return fmt.Errorf("%w: rate %d is out of range", ErrInvalidFee, f.Rate)
+	}
+	if f.Max > 0 && f.Max < f.Min {
+		return fmt.Errorf("%w: max %d is less than min %d", ErrInvalidFee, f.Max, f.Min)
+	}
+	return nil
+}
+
+//FeeRevenue - доход от комиссий за период [From, To)
+type FeeRevenue struct {
+	From       time.Time                             `json:"from"`
+	To         time.Time                             `json:"to"`
+	Charged    types.Money                           `json:"charged"`
+	Refunded   types.Money                           `json:"refunded"`
+	Net        types.Money                           `json:"net"`
+	ByCategory map[types.PaymentCategory]types.Money `json:"byCategory"` // чистый доход по категориям платежей
+}
+
+//SetFeeSchedule заменяет тарифы комиссий. Пустой список отменяет комиссии
+func (s *Service) SetFeeSchedule(fees ...Fee) error {
+	seen := make(map[Fee]bool, len(fees))
+	for _, fee := range fees {
+		if err := fee.validate(); err != nil {
+			return err
+		}
+		tier := Fee{Category: fee.Category, From: fee.From}
+		if seen[tier] {
+			return fmt.Errorf("%w: duplicate tier from %d for %q", ErrInvalidFee, fee.From, fee.Category)
+		}
+		seen[tier] = true
+	}
+
+	s.fees = append([]Fee(nil), fees...)
+	sort.SliceStable(s.fees, func(i, j int) bool {
+		return s.fees[i].From < s.fees[j].From
+	})
+	return nil
+}
+
+//FeeSchedule возвращает действующие тарифы комиссий по возрастанию From
+func (s *Service) FeeSchedule() []Fee {
+	return append([]Fee(nil), s.fees...)
+}
+
+//fee подбирает тариф для платежа и возвращает комиссию, 0 - если тарифа нет
+func (s *Service) fee(amount types.Money, category types.PaymentCategory) types.Money {
+	var own, common *Fee
+	for i := range s.fees {
+		fee := &s.fees[i]
+		if fee.From > amount {
+			continue
+		}
+		switch fee.Category {
+		case category:
+			own = fee
+		case "":
+			common = fee
+		}
+	}
+
+	switch {
+	case own != nil:
+		return own.charge(amount)
+	case common != nil:
+		return common.charge(amount)
+	default:
+		return 0
+	}
+}
+
+//chargeFee записывает проводку комиссии fee за платёж payment. Баланс счёта
+//уменьшает pay вместе с суммой платежа
+func (s *Service) chargeFee(payment *types.Payment, fee types.Money) {
+	entry := &types.Entry{
+		ID:        uuid.New().String(),
+		AccountID: payment.AccountID,
+		Kind:      types.EntryFee,
+		Amount:    fee,
+		PaymentID: payment.ID,
+		Created:   payment.Created,
+	}
+	s.entries = append(s.entries, entry)
+	s.track("entry", entry.ID, nil, *entry)
+}
+
+//refundFee возвращает на счёт ещё не возвращённую комиссию отменённого платежа
+func (s *Service) refundFee(account *types.Account, payment *types.Payment) {
+	var charged, returned types.Money
+	for _, entry := range s.entries {
+		if entry.PaymentID != payment.ID {
+			continue
+		}
+		switch entry.Kind {
+		case types.EntryFee:
+			charged += entry.Amount
+		case types.EntryFeeRefund:
+			returned += entry.Amount
+		}
+	}
+
+	refund := charged - returned
+	if refund <= 0 {
+		return
+	}
+
+	now := s.now()
+	before := *account
+	account.Balance += refund
+	account.Updated = now
+	entry := &types.Entry{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Kind:      types.EntryFeeRefund,
+		Amount:    refund,
+		PaymentID: payment.ID,
+		Created:   now,
+	}
+	s.entries = append(s.entries, entry)
+	s.track("account", strconv.FormatInt(account.ID, 10), before, *account)
+	s.track("entry", entry.ID, nil, *entry)
+}
+
+//FeeRevenue считает доход от комиссий, списанных и возвращённых в [from, to).
+//Нулевое to не ограничивает период
+func (s *Service) FeeRevenue(from time.Time, to time.Time) FeeRevenue {
+	revenue := FeeRevenue{From: from, To: to, ByCategory: make(map[types.PaymentCategory]types.Money)}
+	for _, entry := range s.entries {
+		if entry.Kind != types.EntryFee && entry.Kind != types.EntryFeeRefund {
+			continue
+		}
+		if entry.Created.Before(from) || (!to.IsZero() && !entry.Created.Before(to)) {
+			continue
+		}
+
+		var category types.PaymentCategory
+		if payment, err := s.FindPaymentByID(entry.PaymentID); err == nil {
+			category = payment.Category
+		}
+		if entry.Kind == types.EntryFee {
+			revenue.Charged += entry.Amount
+			revenue.ByCategory[category] += entry.Amount
+		} else {
+			revenue.Refunded += entry.Amount
+			revenue.ByCategory[category] -= entry.Amount
+		}
+	}
+	revenue.Net = revenue.Charged - revenue.Refunded
+	return revenue
+}
+
+//LoadFeeSchedule читает тарифы комиссий из JSON-файла вида
+//{"fees": [{"category": "auto", "from": 100000, "fixed": 500, "rate": 150, "max": 5000}]}
+func LoadFeeSchedule(path string) ([]Fee, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Fees []Fee `json:"fees"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, fee := range file.Fees {
+		if err := fee.validate(); err != nil {
+			return nil, fmt.Errorf("%s: fee %d: %w", path, i+1, err)
+		}
+	}
+	return file.Fees, nil
+}
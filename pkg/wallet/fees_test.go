@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestService_fee(t *testing.T) {
+	s := newTestService()
+	err := s.SetFeeSchedule(
+		Fee{Fixed: 1_00},
+		Fee{Category: "auto", Rate: 200, Min: 5_00},
+		Fee{Category: "auto", From: 1_000_00, Fixed: 10_00, Rate: 100, Max: 25_00},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		amount   types.Money
+		category types.PaymentCategory
+		want     types.Money
+	}{
+		{100_00, "food", 1_00},         // общий тариф
+		{100_00, "auto", 5_00},         // 2% = 200, поднято до минимума
+		{900_00, "auto", 18_00},        // 2%
+		{1_000_00, "auto", 20_00},      // следующая ступень: 1000 + 1%
+		{2_000_00, "auto", 25_00},      // 1000 + 2000, ограничено максимумом
+		{math.MaxInt64, "auto", 25_00}, // amount*Rate не помещается в int64
+	}
+	for _, tt := range tests {
+		if got := s.fee(tt.amount, tt.category); got != tt.want {
+			t.Errorf("fee(%d, %s): want %d, got %d", tt.amount, tt.category, tt.want, got)
+		}
+	}
+
+	whole := Fee{Fixed: 1, Rate: 10_000}
+	if got := whole.charge(math.MaxInt64); got != math.MaxInt64 {
+		t.Errorf("charge(MaxInt64): want %d, got %d", int64(math.MaxInt64), got)
+	}
+}
+
+func TestService_Pay_fees(t *testing.T) {
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+	if err := s.SetFeeSchedule(Fee{Category: "auto", Fixed: 2_00, Rate: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+
+	auto, err := s.Pay(account.ID, 300_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pay(account.ID, 100_00, "food"); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 1_000_00-300_00-5_00-100_00 {
+		t.Errorf("Pay(): want balance 59500, got %v", account.Balance)
+	}
+	//первая проводка - пополнение
+	entries := s.Entries()
+	if len(entries) != 2 || entries[1].Kind != types.EntryFee || entries[1].Amount != 5_00 || entries[1].PaymentID != auto.ID {
+		t.Errorf("Pay(): want fee entry 500 for %v, got %v", auto.ID, entries)
+	}
+
+	//отмена возвращает платёж вместе с комиссией, повторная отмена ничего не возвращает
+	now = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Reject(auto.ID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance != 1_000_00-100_00 {
+		t.Errorf("Reject(): want balance 90000, got %v", account.Balance)
+	}
+	if err := s.Reject(auto.ID); !errors.Is(err, ErrPaymentNotInProgress) {
+		t.Errorf("Reject() twice: want %v, got %v", ErrPaymentNotInProgress, err)
+	}
+	if entries := s.Entries(); len(entries) != 3 || entries[2].Kind != types.EntryFeeRefund || entries[2].Amount != 5_00 {
+		t.Errorf("Reject(): want one fee refund 500, got %v", entries)
+	}
+
+	november := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	revenue := s.FeeRevenue(november, now)
+	if revenue.Charged != 5_00 || revenue.Refunded != 0 || revenue.ByCategory["auto"] != 5_00 {
+		t.Errorf("FeeRevenue(November): want 500 charged, got %+v", revenue)
+	}
+	revenue = s.FeeRevenue(time.Time{}, time.Time{})
+	if revenue.Net != 0 || revenue.Refunded != 5_00 || revenue.ByCategory["auto"] != 0 {
+		t.Errorf("FeeRevenue(): want net 0 after refund, got %+v", revenue)
+	}
+}
+
+func TestService_SetFeeSchedule(t *testing.T) {
+	s := newTestService()
+	invalid := [][]Fee{
+		{{Fixed: -1}},
+		{{Rate: 10_001}},
+		{{Min: 10_00, Max: 5_00}},
+		{{Category: "auto", From: 100}, {Category: "auto", From: 100, Fixed: 1}},
+	}
+	for _, fees := range invalid {
+		if err := s.SetFeeSchedule(fees...); !errors.Is(err, ErrInvalidFee) {
+			t.Errorf("SetFeeSchedule(%+v): want ErrInvalidFee, got %v", fees, err)
+		}
+	}
+	if len(s.FeeSchedule()) != 0 {
+		t.Errorf("SetFeeSchedule(): invalid schedule must not be applied, got %v", s.FeeSchedule())
+	}
+}
+
+func TestLoadFeeSchedule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fees.json")
+	data := `{"fees": [{"category": "auto", "from": 100000, "fixed": 500, "rate": 150, "max": 5000}, {"fixed": 100}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fees, err := LoadFeeSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fee{Category: "auto", From: 1_000_00, Fixed: 5_00, Rate: 150, Max: 50_00}
+	if len(fees) != 2 || fees[0] != want || fees[1] != (Fee{Fixed: 1_00}) {
+		t.Errorf("LoadFeeSchedule(): want %+v and fixed 100, got %+v", want, fees)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"fees": [{"rate": -1}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFeeSchedule(path); !errors.Is(err, ErrInvalidFee) {
+		t.Errorf("LoadFeeSchedule(): want ErrInvalidFee, got %v", err)
+	}
+}
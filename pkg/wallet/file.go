@@ -0,0 +1,239 @@
+package wallet
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//MaxRecordSize - наибольшая длина записи, которую читает ImportFromFile
+const MaxRecordSize = 64 * 1024
+
+var ErrRecordTooLong = errors.New("record is too long")
+
+//ParseError описывает запись выгрузки, которую не удалось разобрать
+type ParseError struct {
+	File   string
+	Line   int    // номер строки для построчных форматов, 0 если строк нет
+	Record int    // номер записи, начиная с 1
+	Offset int64  // смещение записи от начала содержимого файла
+	Text   string // запись, обрезанная до 100 байт
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	var position []string
+	if e.File != "" {
+		position = append(position, e.File)
+	}
+	if e.Line > 0 {
+		position = append(position, "line "+strconv.Itoa(e.Line))
+	} else if e.Record > 0 {
+		position = append(position, "record "+strconv.Itoa(e.Record))
+	}
+
+	message := strings.Join(position, ": ")
+	if e.Text != "" {
+		message += " " + strconv.Quote(e.Text)
+	}
+	if message == "" {
+		return e.Err.Error()
+	}
+	return message + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+//clipRecord обрезает запись для сообщения об ошибке
+func clipRecord(text string) string {
+	const limit = 100
+	if len(text) > limit {
+		return text[:limit] + "..."
+	}
+	return text
+}
+
+//ExportToFile пишет счета одним файлом: записи id;phone;balance, разделённые "|".
+//Поля экранируются так же, как в дампе, см. escapeField
+func (s *Service) ExportToFile(path string, opts ...Option) error {
+	return s.ExportToFileContext(context.Background(), path, opts...)
+}
+
+func (s *Service) ExportToFileContext(ctx context.Context, path string, opts ...Option) error {
+	err := s.exportToFile(ctx, path, newOptions(opts))
+	err = s.runHooks(ctx, OpExportToFile, err)
+	return err
+}
+
+func (s *Service) exportToFile(ctx context.Context, path string, o options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := writeFile(path, func(w io.Writer) error {
+		return encodeTo(w, o.keys, func(w io.Writer) error {
+			return writeAccountRecords(ctx, w, s.accounts)
+		})
+	})
+	return err
+}
+
+//writeAccountRecords пишет счета записями id;phone;balance через "|"
+func writeAccountRecords(ctx context.Context, w io.Writer, accounts []*types.Account) error {
+	for index, account := range accounts {
+		if err := checkContext(ctx, index); err != nil {
+			return err
+		}
+
+		record := joinEscaped([]string{
+			strconv.FormatInt(account.ID, 10),
+			string(account.Phone),
+			strconv.FormatInt(int64(account.Balance), 10),
+		}, ";")
+		if index != len(accounts)-1 {
+			record += "|"
+		}
+		if _, err := io.WriteString(w, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) ImportFromFile(path string, opts ...Option) error {
+	return s.ImportFromFileContext(context.Background(), path, opts...)
+}
+
+//ImportFromFileContext регистрирует счета из файла ExportToFile под новыми ID.
+//Файл читается потоком, поэтому его размер не ограничен; при ошибке разбора
+//возвращается *ParseError, а сервис не меняется
+func (s *Service) ImportFromFileContext(ctx context.Context, path string, opts ...Option) error {
+	err := s.importFromFile(ctx, path, newOptions(opts))
+	err = s.runHooks(ctx, OpImportFromFile, err)
+	return err
+}
+
+func (s *Service) importFromFile(ctx context.Context, path string, o options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decodeFrom(file, o.keys)
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[types.Phone]bool, len(s.accounts))
+	for _, account := range s.accounts {
+		registered[account.Phone] = true
+	}
+
+	var accounts []*types.Account
+	err = readAccountRecords(ctx, reader, func(account *types.Account) error {
+		if registered[account.Phone] {
+			return ErrPhoneRegistered
+		}
+		registered[account.Phone] = true
+		accounts = append(accounts, account)
+		return nil
+	})
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.File = path
+		}
+		return err
+	}
+
+	//телефоны уже проверены, поэтому счета добавляются без поиска registerAccount
+	now := s.now()
+	for _, account := range accounts {
+		s.nextAccountID++
+		account.ID = s.nextAccountID
+		account.Updated = now
+		account.Created = now
+		s.accounts = append(s.accounts, account)
+		s.track("account", strconv.FormatInt(account.ID, 10), nil, *account)
+	}
+	return nil
+}
+
+//readAccountRecords читает записи id;phone;balance, разделённые "|", и
+//передаёт каждую в fn. Ошибки разбора и fn возвращаются как *ParseError
+func readAccountRecords(ctx context.Context, r io.Reader, fn func(account *types.Account) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxRecordSize)
+	scanner.Split(splitRecords)
+
+	offset := int64(0)
+	for record := 1; scanner.Scan(); record++ {
+		if err := checkContext(ctx, record); err != nil {
+			return err
+		}
+
+		text := scanner.Text()
+		account, err := parseAccountRecord(text)
+		if err == nil {
+			err = fn(account)
+		}
+		if err != nil {
+			return &ParseError{Record: record, Offset: offset, Text: clipRecord(text), Err: err}
+		}
+		offset += int64(len(text)) + 1
+	}
+
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			err = fmt.Errorf("%w: more than %d bytes", ErrRecordTooLong, MaxRecordSize)
+		}
+		return &ParseError{Offset: offset, Err: err}
+	}
+	return nil
+}
+
+//splitRecords - bufio.SplitFunc для записей, разделённых неэкранированным "|"
+func splitRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := indexUnescaped(data, '|'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func parseAccountRecord(text string) (*types.Account, error) {
+	fields := splitEscaped(strings.TrimSpace(text), ';')
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("want 3 fields, got %d", len(fields))
+	}
+
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if fields[1] == "" {
+		return nil, errors.New("empty phone")
+	}
+	balance, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.Account{ID: id, Phone: types.Phone(fields[1]), Balance: types.Money(balance)}, nil
+}
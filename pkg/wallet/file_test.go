@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestService_ImportFromFile_large(t *testing.T) {
+	//создаём сервис со счетами на несколько мегабайт
+	s := newTestService()
+	for i := 0; i < 100_000; i++ {
+		s.nextAccountID++
+		s.accounts = append(s.accounts, &types.Account{
+			ID:      s.nextAccountID,
+			Phone:   types.Phone("+99290" + strconv.Itoa(1_000_000+i)),
+			Balance: types.Money(i),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "accounts.txt")
+	if err := s.ExportToFile(path); err != nil {
+		t.Errorf("ExportToFile(): error = %v", err)
+		return
+	}
+
+	imported := newTestService()
+	if err := imported.ImportFromFile(path); err != nil {
+		t.Errorf("ImportFromFile(): error = %v", err)
+		return
+	}
+	if len(imported.accounts) != len(s.accounts) {
+		t.Errorf("ImportFromFile(): want %v accounts, got %v", len(s.accounts), len(imported.accounts))
+		return
+	}
+	last := *imported.accounts[len(imported.accounts)-1]
+	last.Updated, last.Created = time.Time{}, time.Time{}
+	if last != *s.accounts[len(s.accounts)-1] {
+		t.Errorf("ImportFromFile(): want %v got %v", s.accounts[len(s.accounts)-1], last)
+		return
+	}
+}
+
+func TestService_ImportFromFile_parseError(t *testing.T) {
+	tests := []struct {
+		content string
+		record  int
+		want    error
+	}{
+		{content: "1;+992901000876;100|2;+992901000877;abc", record: 2},
+		{content: "1;+992901000876;100|2;+992901000877", record: 2},
+		{content: "1;;100", record: 1},
+		{content: "1;+992901000876;100|2;+992901000876;0", record: 2, want: ErrPhoneRegistered},
+		{content: strings.Repeat("1", MaxRecordSize+1), want: ErrRecordTooLong},
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "accounts.txt")
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		s := newTestService()
+		err := s.ImportFromFile(path)
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("ImportFromFile(%.40q): must return *ParseError, returned = %v", test.content, err)
+			continue
+		}
+		if parseErr.File != path || parseErr.Record != test.record {
+			t.Errorf("ImportFromFile(%.40q): want record %v in %v, got %v in %v", test.content, test.record, path, parseErr.Record, parseErr.File)
+		}
+		if test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("ImportFromFile(%.40q): must return %v, returned = %v", test.content, test.want, err)
+		}
+		if len(s.accounts) != 0 {
+			t.Errorf("ImportFromFile(%.40q): service changed on parse error", test.content)
+		}
+	}
+}
+
+func TestService_ImportFromFile_random(t *testing.T) {
+	//случайные искажения выгрузки не должны приводить к панике
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.addAccount(testAccount{phone: "+992901000877", balance: 1_000_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "accounts.txt")
+	if err := s.ExportToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	alphabet := []byte("0123456789;|+-\n ")
+	for i := 0; i < 1000; i++ {
+		data := append([]byte(nil), valid...)
+		for j := random.Intn(4); j >= 0; j-- {
+			data[random.Intn(len(data))] = alphabet[random.Intn(len(alphabet))]
+		}
+		data = data[:random.Intn(len(data)+1)]
+
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		newTestService().ImportFromFile(path)
+	}
+}
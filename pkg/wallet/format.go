@@ -0,0 +1,769 @@
+package wallet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//Format определяет кодирование файлов, которые пишет Export и читает Import
+type Format int
+
+//Поддерживаемые форматы выгрузки
+const (
+	FormatDump      Format = iota // заголовок с версией и записи вида id;phone;balance; по строке на запись, см. escapeField
+	FormatJSON                    // JSON-массив записей
+	FormatJSONLines               // JSON-объект на каждой строке
+	FormatBinary                  // компактные двоичные записи, см. binary.go
+)
+
+//formats - все поддерживаемые форматы
+var formats = []Format{FormatDump, FormatJSON, FormatJSONLines, FormatBinary}
+
+//ext возвращает расширение файлов выгрузки в формате f
+func (f Format) ext() string {
+	switch f {
+	case FormatJSON:
+		return ".json"
+	case FormatJSONLines:
+		return ".jsonl"
+	case FormatBinary:
+		return ".bin"
+	default:
+		return ".dump"
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatDump:
+		return "dump"
+	case FormatJSON:
+		return "json"
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatBinary:
+		return "binary"
+	default:
+		return "Format(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+//ParseFormat возвращает формат по его имени: dump, json, jsonl или binary
+func ParseFormat(name string) (Format, error) {
+	for _, format := range formats {
+		if format.String() == name {
+			return format, nil
+		}
+	}
+	return FormatDump, fmt.Errorf("unknown format %q", name)
+}
+
+//Option настраивает Export и Import
+type Option func(*options)
+
+type options struct {
+	format   Format
+	manifest ManifestPolicy
+	keys     KeyProvider
+	merge    MergeStrategy
+	summary  *ImportSummary
+}
+
+func newOptions(opts []Option) options {
+	o := options{format: FormatDump}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+//WithFormat выбирает формат файлов выгрузки, по умолчанию FormatDump
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+//snapshot - записи сервиса, прочитанные из выгрузки или подготовленные для неё
+type snapshot struct {
+	accounts  []*types.Account
+	payments  []*types.Payment
+	favorites []*types.Favorite
+	entries   []*types.Entry
+	attempts  []FraudAttempt
+	accruals  []*accrual
+	limits    []Limit
+	budgets   []Budget
+}
+
+//section связывает файл выгрузки с записями снапшота
+type section struct {
+	name   string
+	count  func(snap *snapshot) int
+	fields func(snap *snapshot, i int) []string
+	record func(snap *snapshot, i int) interface{}
+	parse  func(snap *snapshot, fields []string) error
+	decode func(snap *snapshot, dec *json.Decoder) error
+
+	writeBinary func(snap *snapshot, i int, enc *binaryEncoder) error
+	readBinary  func(snap *snapshot, dec *binaryDecoder) error
+}
+
+var sections = []section{
+	{
+		name:  "accounts",
+		count: func(snap *snapshot) int { return len(snap.accounts) },
+		fields: func(snap *snapshot, i int) []string {
+			account := snap.accounts[i]
+			//пустое последнее поле сохраняет завершающий ";" старого формата
+			return []string{
+				strconv.FormatInt(account.ID, 10),
+				string(account.Phone),
+				strconv.FormatInt(int64(account.Balance), 10),
+				formatTime(account.Updated),
+				formatTime(account.Created),
+				strconv.FormatInt(int64(account.Bonus), 10),
+				"",
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return snap.accounts[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 6 {
+				return fmt.Errorf("want 6 fields, got %d", len(fields))
+			}
+			id, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			balance, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			updated, err := parseTime(fields[3])
+			if err != nil {
+				return err
+			}
+			created, err := parseTime(fields[4])
+			if err != nil {
+				return err
+			}
+			bonus, err := strconv.ParseInt(fields[5], 10, 64)
+			if err != nil {
+				return err
+			}
+			snap.accounts = append(snap.accounts, &types.Account{
+				ID:      id,
+				Phone:   types.Phone(fields[1]),
+				Balance: types.Money(balance),
+				Bonus:   types.Money(bonus),
+				Updated: updated,
+				Created: created,
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			account := &types.Account{}
+			if err := dec.Decode(account); err != nil {
+				return err
+			}
+			snap.accounts = append(snap.accounts, account)
+			return nil
+		},
+		writeBinary: writeAccountBinary,
+		readBinary:  readAccountBinary,
+	},
+	{
+		name:  "payments",
+		count: func(snap *snapshot) int { return len(snap.payments) },
+		fields: func(snap *snapshot, i int) []string {
+			payment := snap.payments[i]
+			return []string{
+				payment.ID,
+				strconv.FormatInt(payment.AccountID, 10),
+				strconv.FormatInt(int64(payment.Amount), 10),
+				string(payment.Category),
+				string(payment.Status),
+				formatTime(payment.Updated),
+				formatTime(payment.Created),
+				payment.FavoriteID,
+				"",
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return snap.payments[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 8 {
+				return fmt.Errorf("want 8 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			updated, err := parseTime(fields[5])
+			if err != nil {
+				return err
+			}
+			created, err := parseTime(fields[6])
+			if err != nil {
+				return err
+			}
+			snap.payments = append(snap.payments, &types.Payment{
+				ID:         fields[0],
+				AccountID:  accountID,
+				Amount:     types.Money(amount),
+				Category:   types.PaymentCategory(fields[3]),
+				Status:     types.PaymentStatus(fields[4]),
+				Updated:    updated,
+				Created:    created,
+				FavoriteID: fields[7],
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			payment := &types.Payment{}
+			if err := dec.Decode(payment); err != nil {
+				return err
+			}
+			snap.payments = append(snap.payments, payment)
+			return nil
+		},
+		writeBinary: writePaymentBinary,
+		readBinary:  readPaymentBinary,
+	},
+	{
+		name:  "favorites",
+		count: func(snap *snapshot) int { return len(snap.favorites) },
+		fields: func(snap *snapshot, i int) []string {
+			favorite := snap.favorites[i]
+			return []string{
+				favorite.ID,
+				strconv.FormatInt(favorite.AccountID, 10),
+				favorite.Name,
+				strconv.FormatInt(int64(favorite.Amount), 10),
+				string(favorite.Category),
+				formatTime(favorite.Updated),
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return snap.favorites[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 6 {
+				return fmt.Errorf("want 6 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return err
+			}
+			updated, err := parseTime(fields[5])
+			if err != nil {
+				return err
+			}
+			snap.favorites = append(snap.favorites, &types.Favorite{
+				ID:        fields[0],
+				AccountID: accountID,
+				Name:      fields[2],
+				Amount:    types.Money(amount),
+				Category:  types.PaymentCategory(fields[4]),
+				Updated:   updated,
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			favorite := &types.Favorite{}
+			if err := dec.Decode(favorite); err != nil {
+				return err
+			}
+			snap.favorites = append(snap.favorites, favorite)
+			return nil
+		},
+		writeBinary: writeFavoriteBinary,
+		readBinary:  readFavoriteBinary,
+	},
+	{
+		name:  "entries",
+		count: func(snap *snapshot) int { return len(snap.entries) },
+		fields: func(snap *snapshot, i int) []string {
+			entry := snap.entries[i]
+			return []string{
+				entry.ID,
+				strconv.FormatInt(entry.AccountID, 10),
+				string(entry.Kind),
+				strconv.FormatInt(int64(entry.Amount), 10),
+				entry.PaymentID,
+				entry.Note,
+				formatTime(entry.Created),
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return snap.entries[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 7 {
+				return fmt.Errorf("want 7 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return err
+			}
+			created, err := parseTime(fields[6])
+			if err != nil {
+				return err
+			}
+			snap.entries = append(snap.entries, &types.Entry{
+				ID:        fields[0],
+				AccountID: accountID,
+				Kind:      types.EntryKind(fields[2]),
+				Amount:    types.Money(amount),
+				PaymentID: fields[4],
+				Note:      fields[5],
+				Created:   created,
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			entry := &types.Entry{}
+			if err := dec.Decode(entry); err != nil {
+				return err
+			}
+			snap.entries = append(snap.entries, entry)
+			return nil
+		},
+		writeBinary: writeEntryBinary,
+		readBinary:  readEntryBinary,
+	},
+	{
+		name:  "fraud_attempts",
+		count: func(snap *snapshot) int { return len(snap.attempts) },
+		fields: func(snap *snapshot, i int) []string {
+			attempt := snap.attempts[i]
+			return []string{
+				attempt.ID,
+				formatTime(attempt.Time),
+				strconv.FormatInt(attempt.AccountID, 10),
+				strconv.FormatInt(int64(attempt.Amount), 10),
+				string(attempt.Category),
+				string(attempt.Decision),
+				attempt.Rule,
+				attempt.Reason,
+				attempt.PaymentID,
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return &snap.attempts[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 9 {
+				return fmt.Errorf("want 9 fields, got %d", len(fields))
+			}
+			created, err := parseTime(fields[1])
+			if err != nil {
+				return err
+			}
+			accountID, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return err
+			}
+			snap.attempts = append(snap.attempts, FraudAttempt{
+				ID:        fields[0],
+				Time:      created,
+				AccountID: accountID,
+				Amount:    types.Money(amount),
+				Category:  types.PaymentCategory(fields[4]),
+				Decision:  Decision(fields[5]),
+				Rule:      fields[6],
+				Reason:    fields[7],
+				PaymentID: fields[8],
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			var attempt FraudAttempt
+			if err := dec.Decode(&attempt); err != nil {
+				return err
+			}
+			snap.attempts = append(snap.attempts, attempt)
+			return nil
+		},
+		writeBinary: writeFraudAttemptBinary,
+		readBinary:  readFraudAttemptBinary,
+	},
+	{
+		name:  "accruals",
+		count: func(snap *snapshot) int { return len(snap.accruals) },
+		fields: func(snap *snapshot, i int) []string {
+			state := snap.accruals[i]
+			return []string{
+				strconv.FormatInt(state.AccountID, 10),
+				formatTime(state.Through),
+				state.Accrued.String(),
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return snap.accruals[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 3 {
+				return fmt.Errorf("want 3 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			through, err := parseTime(fields[1])
+			if err != nil {
+				return err
+			}
+			accrued, ok := new(big.Rat).SetString(fields[2])
+			if !ok {
+				return fmt.Errorf("invalid accrued interest %q", fields[2])
+			}
+			snap.accruals = append(snap.accruals, &accrual{AccountID: accountID, Through: through, Accrued: accrued})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			state := &accrual{}
+			if err := dec.Decode(state); err != nil {
+				return err
+			}
+			if state.Accrued == nil {
+				state.Accrued = new(big.Rat)
+			}
+			snap.accruals = append(snap.accruals, state)
+			return nil
+		},
+		writeBinary: writeAccrualBinary,
+		readBinary:  readAccrualBinary,
+	},
+	{
+		name:  "limits",
+		count: func(snap *snapshot) int { return len(snap.limits) },
+		fields: func(snap *snapshot, i int) []string {
+			limit := snap.limits[i]
+			return []string{
+				strconv.FormatInt(limit.AccountID, 10),
+				string(limit.Category),
+				string(limit.Period),
+				strconv.FormatBool(limit.Rolling),
+				strconv.FormatInt(int64(limit.Amount), 10),
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return &snap.limits[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 5 {
+				return fmt.Errorf("want 5 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			rolling, err := strconv.ParseBool(fields[3])
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[4], 10, 64)
+			if err != nil {
+				return err
+			}
+			snap.limits = append(snap.limits, Limit{
+				AccountID: accountID,
+				Category:  types.PaymentCategory(fields[1]),
+				Period:    LimitPeriod(fields[2]),
+				Rolling:   rolling,
+				Amount:    types.Money(amount),
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			var limit Limit
+			if err := dec.Decode(&limit); err != nil {
+				return err
+			}
+			snap.limits = append(snap.limits, limit)
+			return nil
+		},
+		writeBinary: writeLimitBinary,
+		readBinary:  readLimitBinary,
+	},
+	{
+		name:  "budgets",
+		count: func(snap *snapshot) int { return len(snap.budgets) },
+		fields: func(snap *snapshot, i int) []string {
+			budget := snap.budgets[i]
+			return []string{
+				strconv.FormatInt(budget.AccountID, 10),
+				string(budget.Category),
+				strconv.FormatInt(int64(budget.Amount), 10),
+			}
+		},
+		record: func(snap *snapshot, i int) interface{} { return &snap.budgets[i] },
+		parse: func(snap *snapshot, fields []string) error {
+			if len(fields) < 3 {
+				return fmt.Errorf("want 3 fields, got %d", len(fields))
+			}
+			accountID, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return err
+			}
+			amount, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			snap.budgets = append(snap.budgets, Budget{
+				AccountID: accountID,
+				Category:  types.PaymentCategory(fields[1]),
+				Amount:    types.Money(amount),
+			})
+			return nil
+		},
+		decode: func(snap *snapshot, dec *json.Decoder) error {
+			var budget Budget
+			if err := dec.Decode(&budget); err != nil {
+				return err
+			}
+			snap.budgets = append(snap.budgets, budget)
+			return nil
+		},
+		writeBinary: writeBudgetBinary,
+		readBinary:  readBudgetBinary,
+	},
+}
+
+//formatTime записывает время в дамп числом наносекунд Unix, нулевое время - 0
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func parseTime(field string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
+
+//encodeSection пишет записи секции в w в формате format
+func encodeSection(ctx context.Context, w io.Writer, format Format, sec section, snap *snapshot) error {
+	count := sec.count(snap)
+
+	switch format {
+	case FormatJSON:
+		if _, err := io.WriteString(w, "[\n"); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := checkContext(ctx, i); err != nil {
+				return err
+			}
+			data, err := json.Marshal(sec.record(snap, i))
+			if err != nil {
+				return err
+			}
+			separator := ",\n"
+			if i == count-1 {
+				separator = "\n"
+			}
+			if _, err := w.Write(append(append([]byte("  "), data...), separator...)); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]\n")
+		return err
+	case FormatBinary:
+		enc := newBinaryEncoder(w)
+		if err := writeBinaryHeader(enc, sec.name, count); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := checkContext(ctx, i); err != nil {
+				return err
+			}
+			if err := sec.writeBinary(snap, i, enc); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatJSONLines:
+		encoder := json.NewEncoder(w)
+		for i := 0; i < count; i++ {
+			if err := checkContext(ctx, i); err != nil {
+				return err
+			}
+			if err := encoder.Encode(sec.record(snap, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if _, err := io.WriteString(w, dumpHeader(sec.name)+"\n"); err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			if err := checkContext(ctx, i); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, joinEscaped(sec.fields(snap, i), ";")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+//recordFunc получает каждую запись секции, прочитанную decodeSection: позицию
+//записи и Err - ошибку её разбора или nil. Ошибка recordFunc прерывает чтение
+type recordFunc func(record *ParseError) error
+
+//errSkipSection прекращает чтение секции, остаток которой не разобрать
+var errSkipSection = errors.New("skip section")
+
+//visit передаёт запись onRecord, а без onRecord возвращает ошибку разбора записи
+func visit(onRecord recordFunc, record ParseError) error {
+	if onRecord == nil {
+		if record.Err != nil {
+			return &record
+		}
+		return nil
+	}
+	return onRecord(&record)
+}
+
+//decodeSection читает записи секции из r и добавляет их в snap. Без onRecord
+//возвращается первая ошибка разбора, с onRecord чтение продолжается со следующей записи
+func decodeSection(ctx context.Context, r io.Reader, format Format, sec section, snap *snapshot, onRecord recordFunc) error {
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		for i := 0; dec.More(); i++ {
+			if err := checkContext(ctx, i); err != nil {
+				return err
+			}
+			err := sec.decode(snap, dec)
+			if verr := visit(onRecord, ParseError{Record: i + 1, Offset: dec.InputOffset(), Err: err}); verr != nil {
+				return verr
+			}
+			var typeErr *json.UnmarshalTypeError
+			if err != nil && !errors.As(err, &typeErr) {
+				//после синтаксической ошибки декодер не продолжает чтение
+				return nil
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		return nil
+	case FormatBinary:
+		dec := newBinaryDecoder(r)
+		count, err := readBinaryHeader(dec, sec.name)
+		if err != nil {
+			return visit(onRecord, ParseError{Offset: dec.offset, Err: err})
+		}
+		for i := uint64(0); i < count; i++ {
+			if err := checkContext(ctx, int(i)); err != nil {
+				return err
+			}
+			offset := dec.offset
+			err := sec.readBinary(snap, dec)
+			if verr := visit(onRecord, ParseError{Record: int(i) + 1, Offset: offset, Err: err}); verr != nil {
+				return verr
+			}
+			if err != nil {
+				//границы следующей записи после ошибки не известны
+				return nil
+			}
+		}
+		if _, err := dec.ReadByte(); err != io.EOF {
+			return visit(onRecord, ParseError{Offset: dec.offset, Err: fmt.Errorf("%w: data after last record", ErrInvalidBinary)})
+		}
+		return nil
+	case FormatJSONLines:
+		record := 0
+		return readLines(ctx, r, func(line int, text string) error {
+			record++
+			dec := json.NewDecoder(strings.NewReader(text))
+			err := sec.decode(snap, dec)
+			return visit(onRecord, ParseError{Line: line, Record: record, Text: clipRecord(text), Err: err})
+		})
+	default:
+		version := 0
+		record := 0
+		err := readLines(ctx, r, func(line int, text string) error {
+			if version == 0 {
+				var header bool
+				var err error
+				version, header, err = parseDumpHeader(sec.name, text)
+				if err != nil {
+					if verr := visit(onRecord, ParseError{Line: line, Text: clipRecord(text), Err: err}); verr != nil {
+						return verr
+					}
+					//без версии записи не разобрать
+					return errSkipSection
+				}
+				if header {
+					return nil
+				}
+			}
+
+			record++
+			fields, err := migrateFields(sec.name, version, splitDumpFields(version, text))
+			if err == nil {
+				err = sec.parse(snap, fields)
+			}
+			return visit(onRecord, ParseError{Line: line, Record: record, Text: clipRecord(text), Err: err})
+		})
+		if err == errSkipSection {
+			return nil
+		}
+		return err
+	}
+}
+
+//readLines вызывает fn для каждой непустой строки r без завершающего перевода
+//строки. Строки длиннее MaxRecordSize считаются ошибкой, как и в file.go
+func readLines(ctx context.Context, r io.Reader, fn func(line int, text string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		if err := checkContext(ctx, line); err != nil {
+			return err
+		}
+
+		if text := scanner.Text(); text != "" {
+			if err := fn(line, text); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := scanner.Err()
+	if err == bufio.ErrTooLong {
+		err = fmt.Errorf("%w: more than %d bytes", ErrRecordTooLong, MaxRecordSize)
+	}
+	return err
+}
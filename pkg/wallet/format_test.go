@@ -0,0 +1,116 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestService_Export_formatsRoundTrip(t *testing.T) {
+	//создаём сервис
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := s.Export(dir); err != nil {
+		t.Errorf("Export(): error = %v", err)
+		return
+	}
+
+	for _, format := range []Format{FormatJSON, FormatJSONLines, FormatBinary} {
+		//dump -> json/jsonl/binary -> dump должен дать те же файлы
+		fromDump := newTestService()
+		if err := fromDump.Import(dir); err != nil {
+			t.Errorf("Import(): error = %v", err)
+			return
+		}
+		if err := fromDump.Export(dir, WithFormat(format)); err != nil {
+			t.Errorf("Export(%v): error = %v", format, err)
+			return
+		}
+
+		fromFormat := newTestService()
+		if err := fromFormat.Import(dir, WithFormat(format)); err != nil {
+			t.Errorf("Import(%v): error = %v", format, err)
+			return
+		}
+
+		if !reflect.DeepEqual(s.snapshot(), fromFormat.snapshot()) {
+			t.Errorf("Import(%v): records differ, want %v got %v", format, s.snapshot(), fromFormat.snapshot())
+			return
+		}
+
+		redumped, err := ioutil.TempDir("", "wallet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(redumped)
+
+		if err := fromFormat.Export(redumped); err != nil {
+			t.Errorf("Export(): error = %v", err)
+			return
+		}
+		for _, name := range []string{"accounts.dump", "payments.dump", "favorites.dump"} {
+			want, _ := ioutil.ReadFile(filepath.Join(dir, name))
+			got, _ := ioutil.ReadFile(filepath.Join(redumped, name))
+			if string(want) != string(got) {
+				t.Errorf("Export() after %v: %s differs, want %q got %q", format, name, want, got)
+			}
+		}
+	}
+}
+
+func TestService_Import_invalidJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "{\"id\":1,\"phone\":\"+992901000876\",\"balance\":100}\n{\"id\":\"two\"}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "accounts.jsonl"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService()
+	if err := s.Import(dir, WithFormat(FormatJSONLines)); err == nil {
+		t.Error("Import(): must return error, returned nil")
+		return
+	}
+
+	//сервис не должен быть заполнен частично
+	if len(s.accounts) != 0 {
+		t.Errorf("Import(): service changed on error, accounts = %v", s.accounts)
+		return
+	}
+}
+
+func TestService_Import_jsonLineTooLong(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "{\"id\":1,\"phone\":\"" + strings.Repeat("9", MaxRecordSize) + "\"}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "accounts.jsonl"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService()
+	if err := s.Import(dir, WithFormat(FormatJSONLines)); !errors.Is(err, ErrRecordTooLong) {
+		t.Errorf("Import(): error = %v, want %v", err, ErrRecordTooLong)
+	}
+}
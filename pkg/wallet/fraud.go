@@ -0,0 +1,302 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+var ErrPaymentDenied = errors.New("payment denied by fraud rules")
+var ErrInvalidFraudRule = errors.New("invalid fraud rule")
+
+//Decision - решение антифрод-проверки о платеже
+type Decision string
+
+//Решения антифрод-проверки в порядке строгости
+const (
+	DecisionAllow  Decision = "allow"  // платёж проводится
+	DecisionReview Decision = "review" // платёж проводится, но попытка записывается для проверки
+	DecisionDeny   Decision = "deny"   // платёж отклоняется, попытка записывается
+)
+
+func (d Decision) severity() int {
+	switch d {
+	case DecisionReview:
+		return 1
+	case DecisionDeny:
+		return 2
+	default:
+		return 0
+	}
+}
+
+//PaymentAttempt - платёж, который проверяют правила до списания денег
+type PaymentAttempt struct {
+	Account  types.Account
+	Amount   types.Money
+	Category types.PaymentCategory
+	Time     time.Time
+	History  []types.Payment // прежние платежи счёта в порядке создания
+}
+
+//FraudRule - правило антифрод-проверки. Check возвращает решение и причину
+//для сработавшего правила и DecisionAllow для остальных
+type FraudRule interface {
+	Name() string
+	Check(attempt PaymentAttempt) (Decision, string)
+}
+
+//FraudAttempt - запись о платеже, который правила отклонили или отправили на
+//проверку. Попытки выгружаются вместе с остальными записями сервиса
+type FraudAttempt struct {
+	ID        string                `json:"id"`
+	Time      time.Time             `json:"time"`
+	AccountID int64                 `json:"accountId"`
+	Amount    types.Money           `json:"amount"`
+	Category  types.PaymentCategory `json:"category"`
+	Decision  Decision              `json:"decision"`
+	Rule      string                `json:"rule"`
+	Reason    string                `json:"reason"`
+	PaymentID string                `json:"paymentId,omitempty"` // платёж, проведённый с решением review
+}
+
+//FraudError возвращается Pay, Repeat и PayFromFavorite, если правило отклонило платёж
+type FraudError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *FraudError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrPaymentDenied, e.Rule, e.Reason)
+}
+
+func (e *FraudError) Unwrap() error {
+	return ErrPaymentDenied
+}
+
+//SetFraudRules задаёт правила, которыми проверяется каждый платёж до списания.
+//Из сработавших правил выбирается самое строгое решение
+func (s *Service) SetFraudRules(rules ...FraudRule) {
+	s.fraudRules = rules
+}
+
+//FraudAttempts возвращает отклонённые и отправленные на проверку платежи
+func (s *Service) FraudAttempts() []FraudAttempt {
+	return append([]FraudAttempt(nil), s.fraudAttempts...)
+}
+
+//recordAttempt сохраняет попытку платежа. В аудит она пишется и тогда, когда
+//платёж отклонён и операция завершилась ошибкой
+func (s *Service) recordAttempt(attempt FraudAttempt) {
+	attempt.ID = uuid.New().String()
+	s.fraudAttempts = append(s.fraudAttempts, attempt)
+	s.trackAlways("fraud_attempt", attempt.ID, nil, attempt)
+}
+
+//screen проверяет платёж правилами. Отклонённая попытка записывается и
+//возвращается как *FraudError, а для решения review возвращается запись попытки
+func (s *Service) screen(account *types.Account, amount types.Money, category types.PaymentCategory, now time.Time) (*FraudAttempt, error) {
+	if len(s.fraudRules) == 0 {
+		return nil, nil
+	}
+
+	attempt := PaymentAttempt{Account: *account, Amount: amount, Category: category, Time: now}
+	for _, payment := range s.payments {
+		if payment.AccountID == account.ID {
+			attempt.History = append(attempt.History, *payment)
+		}
+	}
+
+	verdict := FraudAttempt{
+		Time:      now,
+		AccountID: account.ID,
+		Amount:    amount,
+		Category:  category,
+		Decision:  DecisionAllow,
+	}
+	for _, rule := range s.fraudRules {
+		decision, reason := rule.Check(attempt)
+		if decision.severity() > verdict.Decision.severity() {
+			verdict.Decision, verdict.Rule, verdict.Reason = decision, rule.Name(), reason
+		}
+	}
+
+	switch verdict.Decision {
+	case DecisionDeny:
+		s.recordAttempt(verdict)
+		log.Printf("Payment of account %d denied by %s: %s", account.ID, verdict.Rule, verdict.Reason)
+		return nil, &FraudError{Rule: verdict.Rule, Reason: verdict.Reason}
+	case DecisionReview:
+		return &verdict, nil
+	default:
+		return nil, nil
+	}
+}
+
+//VelocityRule срабатывает, если за Window со счёта уже сделано MaxPayments платежей
+type VelocityRule struct {
+	MaxPayments int
+	Window      time.Duration
+	Action      Decision
+}
+
+func (r VelocityRule) Name() string { return "velocity" }
+
+func (r VelocityRule) Check(attempt PaymentAttempt) (Decision, string) {
+	since := attempt.Time.Add(-r.Window)
+	count := 0
+	for _, payment := range attempt.History {
+		if payment.Created.After(since) {
+			count++
+		}
+	}
+	if count < r.MaxPayments {
+		return DecisionAllow, ""
+	}
+	return r.Action, fmt.Sprintf("%d payments in %v", count+1, r.Window)
+}
+
+//AmountSpikeRule срабатывает, если сумма больше средней суммы прежних платежей
+//счёта в Factor раз. Пока платежей меньше MinHistory, правило не применяется
+type AmountSpikeRule struct {
+	Factor     float64
+	MinHistory int
+	Action     Decision
+}
+
+func (r AmountSpikeRule) Name() string { return "amount_spike" }
+
+func (r AmountSpikeRule) Check(attempt PaymentAttempt) (Decision, string) {
+	var total types.Money
+	count := 0
+	for _, payment := range attempt.History {
+		if payment.Status != types.PaymentStatusFail {
+			total += payment.Amount
+			count++
+		}
+	}
+	if count == 0 || count < r.MinHistory {
+		return DecisionAllow, ""
+	}
+
+	average := float64(total) / float64(count)
+	if float64(attempt.Amount) <= average*r.Factor {
+		return DecisionAllow, ""
+	}
+	return r.Action, fmt.Sprintf("amount %d is %.1f times the average %.0f", attempt.Amount, float64(attempt.Amount)/average, average)
+}
+
+//NewAccountRule ограничивает сумму платежа счетов, зарегистрированных менее MaxAge
+//назад. Счета с неизвестным временем регистрации новыми не считаются
+type NewAccountRule struct {
+	MaxAge    time.Duration
+	MaxAmount types.Money
+	Action    Decision
+}
+
+func (r NewAccountRule) Name() string { return "new_account" }
+
+func (r NewAccountRule) Check(attempt PaymentAttempt) (Decision, string) {
+	created := attempt.Account.Created
+	if created.IsZero() || attempt.Time.Sub(created) >= r.MaxAge || attempt.Amount <= r.MaxAmount {
+		return DecisionAllow, ""
+	}
+	return r.Action, fmt.Sprintf("amount %d exceeds %d for account younger than %v", attempt.Amount, r.MaxAmount, r.MaxAge)
+}
+
+//CategoryRule срабатывает на платежи запрещённых категорий
+type CategoryRule struct {
+	Categories []types.PaymentCategory
+	Action     Decision
+}
+
+func (r CategoryRule) Name() string { return "category" }
+
+func (r CategoryRule) Check(attempt PaymentAttempt) (Decision, string) {
+	for _, category := range r.Categories {
+		if attempt.Category == category {
+			return r.Action, fmt.Sprintf("category %q is blacklisted", category)
+		}
+	}
+	return DecisionAllow, ""
+}
+
+//fraudRuleConfig - правило в файле LoadFraudRules. Поля, не нужные типу правила, игнорируются
+type fraudRuleConfig struct {
+	Type        string                  `json:"type"`
+	Action      Decision                `json:"action"`
+	MaxPayments int                     `json:"maxPayments"`
+	Window      string                  `json:"window"`
+	Factor      float64                 `json:"factor"`
+	MinHistory  int                     `json:"minHistory"`
+	MaxAge      string                  `json:"maxAge"`
+	MaxAmount   types.Money             `json:"maxAmount"`
+	Categories  []types.PaymentCategory `json:"categories"`
+}
+
+//LoadFraudRules читает правила из JSON-файла вида
+//{"rules": [{"type": "velocity", "maxPayments": 5, "window": "1m", "action": "deny"}]}.
+//Типы правил: velocity, amount_spike (factor, minHistory), new_account (maxAge,
+//maxAmount) и category (categories)
+func LoadFraudRules(path string) ([]FraudRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Rules []fraudRuleConfig `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rules := make([]FraudRule, 0, len(file.Rules))
+	for i, config := range file.Rules {
+		rule, err := config.rule()
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (c fraudRuleConfig) rule() (FraudRule, error) {
+	if c.Action != DecisionReview && c.Action != DecisionDeny {
+		return nil, fmt.Errorf("%w: action must be review or deny, got %q", ErrInvalidFraudRule, c.Action)
+	}
+
+	switch c.Type {
+	case "velocity":
+		window, err := time.ParseDuration(c.Window)
+		if err != nil || window <= 0 || c.MaxPayments <= 0 {
+			return nil, fmt.Errorf("%w: velocity needs positive maxPayments and window", ErrInvalidFraudRule)
+		}
+		return VelocityRule{MaxPayments: c.MaxPayments, Window: window, Action: c.Action}, nil
+	case "amount_spike":
+		if c.Factor <= 1 {
+			return nil, fmt.Errorf("%w: amount_spike needs factor greater than 1", ErrInvalidFraudRule)
+		}
+		return AmountSpikeRule{Factor: c.Factor, MinHistory: c.MinHistory, Action: c.Action}, nil
+	case "new_account":
+		maxAge, err := time.ParseDuration(c.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("%w: new_account needs positive maxAge", ErrInvalidFraudRule)
+		}
+		return NewAccountRule{MaxAge: maxAge, MaxAmount: c.MaxAmount, Action: c.Action}, nil
+	case "category":
+		if len(c.Categories) == 0 {
+			return nil, fmt.Errorf("%w: category needs categories", ErrInvalidFraudRule)
+		}
+		return CategoryRule{Categories: c.Categories, Action: c.Action}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidFraudRule, c.Type)
+	}
+}
@@ -0,0 +1,211 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestFraudRules_Check(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	history := []types.Payment{
+		{Amount: 100_00, Created: now.Add(-2 * time.Hour)},
+		{Amount: 300_00, Created: now.Add(-30 * time.Second)},
+		{Amount: 200_00, Created: now.Add(-10 * time.Second)},
+		{Amount: 900_000_00, Status: types.PaymentStatusFail, Created: now.Add(-5 * time.Second)},
+	}
+	old := types.Account{ID: 1, Created: now.Add(-30 * 24 * time.Hour)}
+	fresh := types.Account{ID: 2, Created: now.Add(-time.Hour)}
+
+	tests := []struct {
+		rule    FraudRule
+		attempt PaymentAttempt
+		want    Decision
+	}{
+		{VelocityRule{MaxPayments: 3, Window: time.Minute, Action: DecisionDeny}, PaymentAttempt{History: history}, DecisionDeny},
+		{VelocityRule{MaxPayments: 4, Window: time.Minute, Action: DecisionDeny}, PaymentAttempt{History: history}, DecisionAllow},
+		//неудачные платежи не входят в среднее: 200 * 3 < 700
+		{AmountSpikeRule{Factor: 3, Action: DecisionReview}, PaymentAttempt{Amount: 700_00, History: history}, DecisionReview},
+		{AmountSpikeRule{Factor: 3, Action: DecisionReview}, PaymentAttempt{Amount: 600_00, History: history}, DecisionAllow},
+		{AmountSpikeRule{Factor: 3, MinHistory: 5, Action: DecisionReview}, PaymentAttempt{Amount: 700_00, History: history}, DecisionAllow},
+		{NewAccountRule{MaxAge: 24 * time.Hour, MaxAmount: 1_000_00, Action: DecisionDeny}, PaymentAttempt{Account: fresh, Amount: 1_000_01}, DecisionDeny},
+		{NewAccountRule{MaxAge: 24 * time.Hour, MaxAmount: 1_000_00, Action: DecisionDeny}, PaymentAttempt{Account: fresh, Amount: 1_000_00}, DecisionAllow},
+		{NewAccountRule{MaxAge: 24 * time.Hour, MaxAmount: 1_000_00, Action: DecisionDeny}, PaymentAttempt{Account: old, Amount: 5_000_00}, DecisionAllow},
+		{NewAccountRule{MaxAge: 24 * time.Hour, MaxAmount: 1_000_00, Action: DecisionDeny}, PaymentAttempt{Account: types.Account{}, Amount: 5_000_00}, DecisionAllow},
+		{CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: DecisionDeny}, PaymentAttempt{Category: "casino"}, DecisionDeny},
+		{CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: DecisionDeny}, PaymentAttempt{Category: "auto"}, DecisionAllow},
+	}
+
+	for i, test := range tests {
+		test.attempt.Time = now
+		if got, reason := test.rule.Check(test.attempt); got != test.want {
+			t.Errorf("%d %s.Check(): want %v got %v (%s)", i, test.rule.Name(), test.want, got, reason)
+		}
+	}
+}
+
+func TestService_Pay_fraudRules(t *testing.T) {
+	s := newTestService()
+	s.SetClock(tickingClock())
+	s.SetFraudRules(
+		CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: DecisionDeny},
+		AmountSpikeRule{Factor: 5, MinHistory: 1, Action: DecisionReview},
+		VelocityRule{MaxPayments: 3, Window: time.Minute, Action: DecisionDeny},
+	)
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 10_000_00); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Pay(account.ID, 100_00, "casino")
+	var fraudErr *FraudError
+	if !errors.Is(err, ErrPaymentDenied) || !errors.As(err, &fraudErr) || fraudErr.Rule != "category" {
+		t.Errorf("Pay(casino): want category FraudError, got %v", err)
+		return
+	}
+	if account.Balance != 10_000_00 || len(s.payments) != 0 {
+		t.Errorf("Pay(casino): denied payment must not debit, balance %v payments %v", account.Balance, len(s.payments))
+	}
+
+	first, err := s.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := s.Pay(account.ID, 1_000_00, "auto")
+	if err != nil {
+		t.Errorf("Pay(spike): review must not block payment, got %v", err)
+		return
+	}
+	//Repeat тоже проходит проверку и упирается в лимит частоты
+	if _, err := s.Repeat(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Repeat(first.ID); !errors.Is(err, ErrPaymentDenied) {
+		t.Errorf("Repeat(): want ErrPaymentDenied, got %v", err)
+	}
+
+	attempts := s.FraudAttempts()
+	var rules []string
+	for _, attempt := range attempts {
+		rules = append(rules, string(attempt.Decision)+" "+attempt.Rule)
+	}
+	want := []string{"deny category", "review amount_spike", "deny velocity"}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("FraudAttempts(): want %v got %v", want, rules)
+		return
+	}
+	if attempts[1].PaymentID != review.ID || attempts[0].PaymentID != "" || attempts[0].Amount != 100_00 {
+		t.Errorf("FraudAttempts(): want review of %v, got %+v", review.ID, attempts)
+	}
+}
+
+func TestService_FraudAttempts_persisted(t *testing.T) {
+	var audit bytes.Buffer
+	s := newTestService()
+	s.SetClock(tickingClock())
+	s.SetAuditLog(NewAuditLog(&audit))
+	s.SetFraudRules(
+		CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: DecisionDeny},
+		CategoryRule{Categories: []types.PaymentCategory{"crypto; exchange"}, Action: DecisionReview},
+	)
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 10_000_00); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Pay(account.ID, 100_00, "casino"); !errors.Is(err, ErrPaymentDenied) {
+		t.Fatalf("Pay(casino): want ErrPaymentDenied, got %v", err)
+	}
+	if _, err := s.Pay(account.ID, 100_00, "crypto; exchange"); err != nil {
+		t.Fatal(err)
+	}
+
+	//отклонённый платёж не меняет записей, но попытка остаётся в аудите
+	records, err := ReadAudit(&audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audited []Decision
+	for _, record := range records {
+		if record.Entity != "fraud_attempt" {
+			continue
+		}
+		var attempt FraudAttempt
+		if err := json.Unmarshal(record.After, &attempt); err != nil {
+			t.Fatal(err)
+		}
+		audited = append(audited, attempt.Decision)
+	}
+	if want := []Decision{DecisionDeny, DecisionReview}; !reflect.DeepEqual(audited, want) {
+		t.Errorf("audit: want fraud attempts %v, got %v", want, audited)
+	}
+
+	//попытки переживают выгрузку в любом формате
+	for _, format := range []Format{FormatDump, FormatJSON, FormatJSONLines, FormatBinary} {
+		dir := t.TempDir()
+		if err := s.Export(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Export(%v): error = %v", format, err)
+		}
+		restored := newTestService()
+		if err := restored.Import(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Import(%v): error = %v", format, err)
+		}
+		if !reflect.DeepEqual(restored.FraudAttempts(), s.FraudAttempts()) {
+			t.Errorf("Import(%v): want %+v got %+v", format, s.FraudAttempts(), restored.FraudAttempts())
+		}
+	}
+}
+
+func TestLoadFraudRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	content := `{"rules": [
+		{"type": "velocity", "maxPayments": 5, "window": "1m", "action": "deny"},
+		{"type": "amount_spike", "factor": 10, "minHistory": 3, "action": "review"},
+		{"type": "new_account", "maxAge": "72h", "maxAmount": 500000, "action": "deny"},
+		{"type": "category", "categories": ["casino"], "action": "deny"}
+	]}`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadFraudRules(path)
+	if err != nil {
+		t.Errorf("LoadFraudRules(): error = %v", err)
+		return
+	}
+	want := []FraudRule{
+		VelocityRule{MaxPayments: 5, Window: time.Minute, Action: DecisionDeny},
+		AmountSpikeRule{Factor: 10, MinHistory: 3, Action: DecisionReview},
+		NewAccountRule{MaxAge: 72 * time.Hour, MaxAmount: 500000, Action: DecisionDeny},
+		CategoryRule{Categories: []types.PaymentCategory{"casino"}, Action: DecisionDeny},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("LoadFraudRules(): want %v got %v", want, rules)
+	}
+
+	for _, invalid := range []string{
+		`{"rules": [{"type": "velocity", "window": "1m", "action": "deny"}]}`,
+		`{"rules": [{"type": "category", "categories": ["casino"], "action": "allow"}]}`,
+		`{"rules": [{"type": "unknown", "action": "deny"}]}`,
+	} {
+		if err := ioutil.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFraudRules(path); !errors.Is(err, ErrInvalidFraudRule) {
+			t.Errorf("LoadFraudRules(%s): want ErrInvalidFraudRule, got %v", invalid, err)
+		}
+	}
+}
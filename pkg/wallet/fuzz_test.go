@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+package wallet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func FuzzReadAccountRecords(f *testing.F) {
+	f.Add("1;+992901000876;400000|2;+992901000877;100000")
+	f.Add("1;;0")
+	f.Add("|||")
+
+	f.Fuzz(func(t *testing.T, content string) {
+		var accounts []*types.Account
+		err := readAccountRecords(context.Background(), strings.NewReader(content), func(account *types.Account) error {
+			accounts = append(accounts, account)
+			return nil
+		})
+
+		var parseErr *ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			t.Errorf("readAccountRecords(%q): must return *ParseError, returned = %v", content, err)
+		}
+		if err == nil && len(accounts) > strings.Count(content, "|")+1 {
+			t.Errorf("readAccountRecords(%q): too many records %v", content, len(accounts))
+		}
+	})
+}
+
+func FuzzSplitEscaped(f *testing.F) {
+	f.Add("Car; monthly", "a|b")
+	f.Add(`back\slash`, "line\n")
+
+	f.Fuzz(func(t *testing.T, first string, second string) {
+		fields := []string{first, second}
+		got := splitEscaped(joinEscaped(fields, ";"), ';')
+		if len(got) != 2 || got[0] != first || got[1] != second {
+			t.Errorf("splitEscaped(joinEscaped(%q)): got %q", fields, got)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidInterestPlan = errors.New("invalid interest plan")
+
+//DayCount - соглашение о счёте дней: какая доля годовой ставки приходится на сутки
+type DayCount string
+
+//Соглашения о счёте дней
+const (
+	DayCountActual365    DayCount = "act/365" // фактические дни, год - 365 дней
+	DayCountActual360    DayCount = "act/360" // фактические дни, год - 360 дней
+	DayCountActualActual DayCount = "act/act" // фактические дни, год - 365 или 366 дней
+	DayCount30360        DayCount = "30/360"  // каждый месяц - 30 дней, год - 360 (30E/360)
+)
+
+//fraction возвращает долю года, приходящуюся на сутки day
+func (c DayCount) fraction(day time.Time) *big.Rat {
+	switch c {
+	case DayCountActual365:
+		return big.NewRat(1, 365)
+	case DayCountActual360:
+		return big.NewRat(1, 360)
+	case DayCountActualActual:
+		year := time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return big.NewRat(1, int64(year.AddDate(1, 0, 0).Sub(year)/(24*time.Hour)))
+	case DayCount30360:
+		return big.NewRat(days360(day.AddDate(0, 0, 1))-days360(day), 360)
+	default:
+		return new(big.Rat)
+	}
+}
+
+//days360 - номер дня по 30E/360: 31-е число считается 30-м. Разность номеров
+//двух дат - число дней между ними, поэтому сумма долей суток за месяц - ровно 30/360
+func days360(day time.Time) int64 {
+	d := day.Day()
+	if d > 30 {
+		d = 30
+	}
+	return int64(day.Year())*360 + int64(day.Month())*30 + int64(d)
+}
+
+//InterestPlan - начисление процентов на положительный баланс счёта по годовой
+//ставке Rate в сотых долях процента (450 - 4.5% годовых). Проценты начисляются
+//ежедневно и капитализируются в начале следующего месяца
+type InterestPlan struct {
+	AccountID int64     `json:"accountId,omitempty"` // 0 - счета без своего плана
+	Rate      int       `json:"rate"`
+	DayCount  DayCount  `json:"dayCount"`
+	Since     time.Time `json:"since,omitempty"` // начало начисления, пусто - момент SetInterestPlan
+}
+
+func (p InterestPlan) validate() error {
+	if p.Rate <= 0 || p.Rate > 100_000 {
+		return fmt.Errorf("%w: rate %d is out of range", ErrInvalidInterestPlan, p.Rate)
+	}
+	switch p.DayCount {
+	case DayCountActual365, DayCountActual360, DayCountActualActual, DayCount30360:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown day count %q", ErrInvalidInterestPlan, p.DayCount)
+}
+
+//accrual - начисленные, но ещё не капитализированные проценты счёта.
+//Выгружается вместе с записями, чтобы после Import проценты не начислялись
+//повторно и не терялись
+type accrual struct {
+	AccountID int64     `json:"accountId"`
+	Through   time.Time `json:"through"` // первые сутки, за которые проценты ещё не начислены
+	Accrued   *big.Rat  `json:"accrued"` // в дирамах, с дробной частью
+}
+
+func (a *accrual) equal(other *accrual) bool {
+	return a.AccountID == other.AccountID && a.Through.Equal(other.Through) && a.Accrued.Cmp(other.Accrued) == 0
+}
+
+//SetInterestPlan задаёт план начисления процентов, заменяя план того же счёта.
+//Уже начисленные проценты сохраняются, новая ставка действует с ближайших
+//неначисленных суток
+func (s *Service) SetInterestPlan(plan InterestPlan) error {
+	if err := plan.validate(); err != nil {
+		return err
+	}
+	if plan.AccountID != 0 {
+		if _, err := s.FindAccountByID(plan.AccountID); err != nil {
+			return err
+		}
+	}
+	if plan.Since.IsZero() {
+		plan.Since = s.now()
+	}
+
+	for i, existing := range s.interestPlans {
+		if existing.AccountID == plan.AccountID {
+			s.interestPlans[i] = plan
+			return nil
+		}
+	}
+	s.interestPlans = append(s.interestPlans, plan)
+	return nil
+}
+
+//LoadInterestPlans читает планы начисления процентов из JSON-файла вида
+//{"plans": [{"rate": 450, "dayCount": "act/365"}, {"accountId": 1, "rate": 600, "dayCount": "30/360"}]}
+func LoadInterestPlans(path string) ([]InterestPlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Plans []InterestPlan `json:"plans"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, plan := range file.Plans {
+		if err := plan.validate(); err != nil {
+			return nil, fmt.Errorf("%s: plan %d: %w", path, i+1, err)
+		}
+	}
+	return file.Plans, nil
+}
+
+//RemoveInterestPlan удаляет план счёта accountID, 0 - общий план. Начисленные
+//проценты капитализируются при следующем AccrueInterest, если у счёта остался план
+func (s *Service) RemoveInterestPlan(accountID int64) bool {
+	for i, existing := range s.interestPlans {
+		if existing.AccountID == accountID {
+			s.interestPlans = append(s.interestPlans[:i:i], s.interestPlans[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//interestPlan возвращает план счёта или общий план
+func (s *Service) interestPlan(accountID int64) (InterestPlan, bool) {
+	var common *InterestPlan
+	for i, plan := range s.interestPlans {
+		switch plan.AccountID {
+		case accountID:
+			return plan, true
+		case 0:
+			common = &s.interestPlans[i]
+		}
+	}
+	if common == nil {
+		return InterestPlan{}, false
+	}
+	return *common, true
+}
+
+//AccruedInterest возвращает проценты счёта, начисленные, но ещё не капитализированные
+func (s *Service) AccruedInterest(accountID int64) (types.Money, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return 0, err
+	}
+	state, ok := s.accruals[accountID]
+	if !ok {
+		return 0, nil
+	}
+	return floorMoney(state.Accrued), nil
+}
+
+//AccrueInterest начисляет проценты всем счетам с планом за сутки, прошедшие с
+//прошлого начисления, и капитализирует проценты за закончившиеся месяцы проводкой
+//types.EntryInterest на начало следующего месяца. Баланс на момент вызова
+//считается балансом всех неначисленных суток, поэтому вызывать его нужно
+//ежедневно. Возвращает проводки капитализации
+func (s *Service) AccrueInterest() ([]*types.Entry, error) {
+	return s.AccrueInterestContext(context.Background())
+}
+
+func (s *Service) AccrueInterestContext(ctx context.Context) ([]*types.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := s.accrueInterest()
+	err := s.runHooks(ctx, OpAccrueInterest, nil)
+	return entries, err
+}
+
+func (s *Service) accrueInterest() []*types.Entry {
+	now := s.now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var capitalized []*types.Entry
+	for _, account := range s.accounts {
+		plan, ok := s.interestPlan(account.ID)
+		if !ok {
+			continue
+		}
+		if s.accruals == nil {
+			s.accruals = make(map[int64]*accrual)
+		}
+		state, ok := s.accruals[account.ID]
+		if !ok {
+			//без сохранённого состояния (выгрузки без accruals) начисление
+			//продолжается с последней капитализации, чтобы не повторить её
+			since := plan.Since
+			if account.Created.After(since) {
+				since = account.Created
+			}
+			if capitalized := s.lastInterest(account.ID); capitalized.After(since) {
+				since = capitalized
+			}
+			since = since.UTC()
+			state = &accrual{
+				AccountID: account.ID,
+				Through:   time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC),
+				Accrued:   new(big.Rat),
+			}
+			s.accruals[account.ID] = state
+		}
+
+		//сутки today ещё не закончились, но в начале месяца проценты уже капитализируются
+		for day := state.Through; !day.After(today); day = day.AddDate(0, 0, 1) {
+			if day.Day() == 1 {
+				if entry := s.capitalize(account, state, day, now); entry != nil {
+					capitalized = append(capitalized, entry)
+				}
+			}
+			if day.Equal(today) {
+				break
+			}
+			if account.Balance > 0 {
+				daily := new(big.Rat).SetInt64(int64(account.Balance))
+				daily.Mul(daily, big.NewRat(int64(plan.Rate), 10_000))
+				daily.Mul(daily, plan.DayCount.fraction(day))
+				state.Accrued.Add(state.Accrued, daily)
+			}
+			state.Through = day.AddDate(0, 0, 1)
+		}
+	}
+	return capitalized
+}
+
+//lastInterest возвращает время последней капитализации процентов счёта
+func (s *Service) lastInterest(accountID int64) time.Time {
+	var last time.Time
+	for _, entry := range s.entries {
+		if entry.AccountID == accountID && entry.Kind == types.EntryInterest && entry.Created.After(last) {
+			last = entry.Created
+		}
+	}
+	return last
+}
+
+//accrualList возвращает состояния начисления по возрастанию номера счёта
+func (s *Service) accrualList() []*accrual {
+	if len(s.accruals) == 0 {
+		return nil
+	}
+	accruals := make([]*accrual, 0, len(s.accruals))
+	for _, state := range s.accruals {
+		accruals = append(accruals, state)
+	}
+	sort.Slice(accruals, func(i, j int) bool {
+		return accruals[i].AccountID < accruals[j].AccountID
+	})
+	return accruals
+}
+
+//capitalize зачисляет на баланс целую часть начисленных за прошедший месяц
+//процентов; дробная часть переходит в следующий месяц
+func (s *Service) capitalize(account *types.Account, state *accrual, month time.Time, now time.Time) *types.Entry {
+	amount := floorMoney(state.Accrued)
+	if amount <= 0 {
+		return nil
+	}
+	state.Accrued.Sub(state.Accrued, new(big.Rat).SetInt64(int64(amount)))
+
+	before := *account
+	account.Balance += amount
+	account.Updated = now
+	entry := &types.Entry{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Kind:      types.EntryInterest,
+		Amount:    amount,
+		Note:      month.AddDate(0, -1, 0).Format("2006-01"),
+		Created:   month,
+	}
+	s.entries = append(s.entries, entry)
+	s.track("account", strconv.FormatInt(account.ID, 10), before, *account)
+	s.track("entry", entry.ID, nil, *entry)
+	return entry
+}
+
+//floorMoney отбрасывает дробную часть дирама
+func floorMoney(amount *big.Rat) types.Money {
+	return types.Money(new(big.Int).Quo(amount.Num(), amount.Denom()).Int64())
+}
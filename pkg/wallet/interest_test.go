@@ -0,0 +1,242 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestDayCount_fraction(t *testing.T) {
+	tests := []struct {
+		dayCount DayCount
+		month    time.Time
+		want     *big.Rat
+	}{
+		{DayCountActual365, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), big.NewRat(31, 365)},
+		{DayCountActual360, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), big.NewRat(28, 360)},
+		{DayCountActualActual, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), big.NewRat(29, 366)},
+		{DayCountActualActual, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), big.NewRat(28, 365)},
+		{DayCount30360, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), big.NewRat(1, 12)},
+		{DayCount30360, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), big.NewRat(1, 12)},
+	}
+	for _, tt := range tests {
+		//сумма долей суток за месяц
+		got := new(big.Rat)
+		for day := tt.month; day.Before(tt.month.AddDate(0, 1, 0)); day = day.AddDate(0, 0, 1) {
+			got.Add(got, tt.dayCount.fraction(day))
+		}
+		if got.Cmp(tt.want) != 0 {
+			t.Errorf("%s in %s: want %v, got %v", tt.dayCount, tt.month.Format("2006-01"), tt.want, got)
+		}
+	}
+}
+
+func TestService_AccrueInterest(t *testing.T) {
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	//36.5% годовых при act/365 - ровно 0.1% в сутки
+	if err := s.SetInterestPlan(InterestPlan{Rate: 36_50, DayCount: DayCountActual365}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = time.Date(2020, 11, 15, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if entries, err := s.AccrueInterest(); err != nil || len(entries) != 0 {
+			t.Fatalf("AccrueInterest(): want no capitalization, got %v, %v", entries, err)
+		}
+	}
+	if accrued, _ := s.AccruedInterest(account.ID); accrued != 5_00 {
+		t.Errorf("AccruedInterest(): want 500 for 5 days, got %v", accrued)
+	}
+
+	//пропущенные дни начисляются при следующем вызове, капитализация - на 1 декабря
+	now = time.Date(2020, 12, 3, 8, 0, 0, 0, time.UTC)
+	entries, err := s.AccrueInterest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := types.Entry{
+		ID:        entries[0].ID,
+		AccountID: account.ID,
+		Kind:      types.EntryInterest,
+		Amount:    21_00,
+		Note:      "2020-11",
+		Created:   time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(entries) != 1 || *entries[0] != want {
+		t.Fatalf("AccrueInterest(): want %+v, got %v", want, entries)
+	}
+	if account.Balance != 1_021_00 {
+		t.Errorf("AccrueInterest(): want balance 102100, got %v", account.Balance)
+	}
+	//в декабре проценты начисляются уже на капитализированный баланс
+	if accrued, _ := s.AccruedInterest(account.ID); accrued != 2_04 {
+		t.Errorf("AccruedInterest(): want 204 for 2 days, got %v", accrued)
+	}
+
+	//отрицательный баланс проценты не приносит
+	if _, err := s.Pay(account.ID, 2_000_00, "auto"); err != nil {
+		t.Fatal(err)
+	}
+	now = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries, err = s.AccrueInterest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Amount != 2_04 || entries[0].Note != "2020-12" {
+		t.Errorf("AccrueInterest(): want 204 for December, got %v", entries)
+	}
+}
+
+func TestService_AccrueInterest_afterImport(t *testing.T) {
+	started := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	now := started
+	clock := func() time.Time { return now }
+	plan := InterestPlan{Rate: 36_50, DayCount: DayCountActual365}
+
+	s := newTestService()
+	s.SetClock(clock)
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetInterestPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	now = time.Date(2020, 12, 3, 8, 0, 0, 0, time.UTC)
+	if _, err := s.AccrueInterest(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range formats {
+		dir := t.TempDir()
+		if err := s.Export(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Export(%v): %v", format, err)
+		}
+
+		//после перезапуска план задаётся заново, начисление продолжается с сохранённого состояния
+		restored := newTestService()
+		restored.SetClock(clock)
+		if err := restored.Import(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Import(%v): %v", format, err)
+		}
+		if err := restored.SetInterestPlan(plan); err != nil {
+			t.Fatal(err)
+		}
+		if entries, err := restored.AccrueInterest(); err != nil || len(entries) != 0 {
+			t.Errorf("AccrueInterest(%v): November must not be capitalized twice, got %v, %v", format, entries, err)
+		}
+		if accrued, _ := restored.AccruedInterest(account.ID); accrued != 2_04 {
+			t.Errorf("AccruedInterest(%v): want 204 for 2 days, got %v", format, accrued)
+		}
+	}
+
+	//выгрузка без состояния: начисление продолжается с последней капитализации
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "accruals.dump")); err != nil {
+		t.Fatal(err)
+	}
+	restored := newTestService()
+	restored.SetClock(clock)
+	if err := restored.Import(dir, WithManifestPolicy(ManifestIgnore)); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.SetInterestPlan(InterestPlan{Rate: plan.Rate, DayCount: plan.DayCount, Since: started}); err != nil {
+		t.Fatal(err)
+	}
+
+	now = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, svc := range []*testService{s, restored} {
+		entries, err := svc.AccrueInterest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Amount != 31_65 || entries[0].Note != "2020-12" {
+			t.Errorf("AccrueInterest(): want 3165 for December, got %v", entries)
+		}
+		if account, _ := svc.FindAccountByID(account.ID); account.Balance != 1_052_65 {
+			t.Errorf("AccrueInterest(): want balance 105265, got %v", account.Balance)
+		}
+	}
+}
+
+func TestLoadInterestPlans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "interest.json")
+	data := `{"plans": [{"rate": 450, "dayCount": "act/365"}, {"accountId": 1, "rate": 600, "dayCount": "30/360"}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plans, err := LoadInterestPlans(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := InterestPlan{AccountID: 1, Rate: 6_00, DayCount: DayCount30360}
+	if len(plans) != 2 || plans[0] != (InterestPlan{Rate: 4_50, DayCount: DayCountActual365}) || plans[1] != want {
+		t.Errorf("LoadInterestPlans(): want common 450 and %+v, got %+v", want, plans)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"plans": [{"rate": 450, "dayCount": "act/364"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadInterestPlans(path); !errors.Is(err, ErrInvalidInterestPlan) {
+		t.Errorf("LoadInterestPlans(): want ErrInvalidInterestPlan, got %v", err)
+	}
+}
+
+func TestService_SetInterestPlan(t *testing.T) {
+	s := newTestService()
+	invalid := []InterestPlan{
+		{Rate: 0, DayCount: DayCountActual365},
+		{Rate: 100_001, DayCount: DayCountActual365},
+		{Rate: 5_00, DayCount: "act/364"},
+	}
+	for _, plan := range invalid {
+		if err := s.SetInterestPlan(plan); !errors.Is(err, ErrInvalidInterestPlan) {
+			t.Errorf("SetInterestPlan(%+v): want ErrInvalidInterestPlan, got %v", plan, err)
+		}
+	}
+	if err := s.SetInterestPlan(InterestPlan{AccountID: 42, Rate: 5_00, DayCount: DayCount30360}); err != ErrAccountNotFound {
+		t.Errorf("SetInterestPlan(): want ErrAccountNotFound, got %v", err)
+	}
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetInterestPlan(InterestPlan{Rate: 5_00, DayCount: DayCount30360}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetInterestPlan(InterestPlan{AccountID: account.ID, Rate: 7_00, DayCount: DayCount30360}); err != nil {
+		t.Fatal(err)
+	}
+	if plan, ok := s.interestPlan(account.ID); !ok || plan.Rate != 7_00 {
+		t.Errorf("interestPlan(): want own plan 700, got %+v", plan)
+	}
+	if !s.RemoveInterestPlan(account.ID) {
+		t.Fatal("RemoveInterestPlan(): want plan removed")
+	}
+	if plan, ok := s.interestPlan(account.ID); !ok || plan.Rate != 5_00 {
+		t.Errorf("interestPlan(): want common plan 500, got %+v", plan)
+	}
+}
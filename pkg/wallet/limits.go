@@ -0,0 +1,190 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+var ErrLimitExceeded = errors.New("spending limit exceeded")
+var ErrInvalidLimit = errors.New("invalid spending limit")
+
+//LimitPeriod - период, за который суммируются платежи лимита
+type LimitPeriod string
+
+//Периоды лимитов
+const (
+	LimitDaily   LimitPeriod = "day"
+	LimitMonthly LimitPeriod = "month"
+)
+
+//Limit ограничивает сумму платежей счёта за период. Календарный лимит считает
+//платежи с начала текущих суток или месяца (UTC), скользящий - за последние
+//сутки или месяц. Отменённые платежи и платежи с неизвестным временем создания
+//не учитываются
+type Limit struct {
+	AccountID int64                 `json:"accountId"`
+	Category  types.PaymentCategory `json:"category,omitempty"` // пусто - все категории
+	Period    LimitPeriod           `json:"period"`
+	Rolling   bool                  `json:"rolling,omitempty"`
+	Amount    types.Money           `json:"amount"`
+}
+
+//key возвращает лимит без суммы: лимиты с одинаковым ключом задают одно ограничение
+func (l Limit) key() Limit {
+	l.Amount = 0
+	return l
+}
+
+func (l Limit) String() string {
+	kind := "calendar"
+	if l.Rolling {
+		kind = "rolling"
+	}
+	category := "all categories"
+	if l.Category != "" {
+		category = string(l.Category)
+	}
+	return fmt.Sprintf("%d per %s %s on %s", l.Amount, kind, l.Period, category)
+}
+
+//start возвращает начало окна лимита для момента now
+func (l Limit) start(now time.Time) time.Time {
+	now = now.UTC()
+	switch {
+	case l.Period == LimitDaily && l.Rolling:
+		return now.Add(-24 * time.Hour)
+	case l.Period == LimitDaily:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	case l.Rolling:
+		return now.AddDate(0, -1, 0)
+	default:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+//LimitUsage - расход по лимиту в текущем окне
+type LimitUsage struct {
+	Limit     Limit       `json:"limit"`
+	Since     time.Time   `json:"since"` // начало окна
+	Used      types.Money `json:"used"`
+	Remaining types.Money `json:"remaining"`
+}
+
+//LimitError возвращается Pay, Repeat и PayFromFavorite, если платёж превысил лимит
+type LimitError struct {
+	Usage  LimitUsage
+	Amount types.Money // сумма отклонённого платежа
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %v, remaining %d, payment %d", ErrLimitExceeded, e.Usage.Limit, e.Usage.Remaining, e.Amount)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+//SetLimit задаёт лимит счёта, заменяя лимит с тем же счётом, категорией и периодом
+func (s *Service) SetLimit(limit Limit) error {
+	if limit.Amount <= 0 {
+		return fmt.Errorf("%w: %v", ErrAmountMustBePositive, limit)
+	}
+	if limit.Period != LimitDaily && limit.Period != LimitMonthly {
+		return fmt.Errorf("%w: unknown period %q", ErrInvalidLimit, limit.Period)
+	}
+	if _, err := s.FindAccountByID(limit.AccountID); err != nil {
+		return err
+	}
+
+	s.putLimit(limit)
+	return nil
+}
+
+//putLimit добавляет лимит или заменяет лимит с тем же ключом
+func (s *Service) putLimit(limit Limit) {
+	for i, existing := range s.limits {
+		if existing.key() == limit.key() {
+			s.limits[i] = limit
+			return
+		}
+	}
+	s.limits = append(s.limits, limit)
+}
+
+//RemoveLimit удаляет лимит с теми же счётом, категорией и периодом, что у limit
+func (s *Service) RemoveLimit(limit Limit) bool {
+	for i, existing := range s.limits {
+		if existing.key() == limit.key() {
+			s.limits = append(s.limits[:i:i], s.limits[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//LimitUsage возвращает расход по всем лимитам счёта на текущий момент
+func (s *Service) LimitUsage(accountID int64) ([]LimitUsage, error) {
+	if _, err := s.FindAccountByID(accountID); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	var usages []LimitUsage
+	for _, limit := range s.limits {
+		if limit.AccountID == accountID {
+			usages = append(usages, s.limitUsage(limit, now))
+		}
+	}
+	return usages, nil
+}
+
+//limitUsage считает платежи, попавшие в окно лимита на момент now
+func (s *Service) limitUsage(limit Limit, now time.Time) LimitUsage {
+	usage := LimitUsage{Limit: limit, Since: limit.start(now)}
+	usage.Used = s.spent(limit.AccountID, limit.Category, usage.Since, time.Time{})
+	usage.Remaining = limit.Amount - usage.Used
+	if usage.Remaining < 0 {
+		usage.Remaining = 0
+	}
+	return usage
+}
+
+//spent суммирует платежи счёта категории category (пусто - всех категорий),
+//созданные в [from, to). Нулевое to не ограничивает период. Отменённые платежи
+//и платежи с неизвестным временем создания не учитываются
+func (s *Service) spent(accountID int64, category types.PaymentCategory, from time.Time, to time.Time) types.Money {
+	var total types.Money
+	for _, payment := range s.payments {
+		if payment.AccountID != accountID || payment.Status == types.PaymentStatusFail {
+			continue
+		}
+		if category != "" && payment.Category != category {
+			continue
+		}
+		if payment.Created.IsZero() || payment.Created.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !payment.Created.Before(to) {
+			continue
+		}
+		total += payment.Amount
+	}
+	return total
+}
+
+//checkLimits проверяет, что платёж не превысит ни один лимит счёта
+func (s *Service) checkLimits(accountID int64, amount types.Money, category types.PaymentCategory, now time.Time) error {
+	for _, limit := range s.limits {
+		if limit.AccountID != accountID || (limit.Category != "" && limit.Category != category) {
+			continue
+		}
+		usage := s.limitUsage(limit, now)
+		if amount > usage.Remaining {
+			return &LimitError{Usage: usage, Amount: amount}
+		}
+	}
+	return nil
+}
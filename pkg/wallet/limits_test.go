@@ -0,0 +1,186 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLimit_start(t *testing.T) {
+	now := time.Date(2020, 11, 15, 13, 30, 0, 0, time.UTC)
+	tests := []struct {
+		limit Limit
+		want  time.Time
+	}{
+		{Limit{Period: LimitDaily}, time.Date(2020, 11, 15, 0, 0, 0, 0, time.UTC)},
+		{Limit{Period: LimitDaily, Rolling: true}, time.Date(2020, 11, 14, 13, 30, 0, 0, time.UTC)},
+		{Limit{Period: LimitMonthly}, time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{Limit{Period: LimitMonthly, Rolling: true}, time.Date(2020, 10, 15, 13, 30, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		if got := test.limit.start(now); !got.Equal(test.want) {
+			t.Errorf("start(%v): want %v got %v", test.limit, test.want, got)
+		}
+	}
+}
+
+func TestService_Pay_limits(t *testing.T) {
+	now := time.Date(2020, 11, 30, 10, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Deposit(account.ID, 100_000_00); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLimit(Limit{AccountID: account.ID, Category: "fun", Period: LimitMonthly, Amount: 5_000_00}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetLimit(Limit{AccountID: account.ID, Period: LimitDaily, Rolling: true, Amount: 8_000_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.Pay(account.ID, 3_000_00, "fun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite, err := s.FavoritePayment(first.ID, "Cinema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.PayFromFavorite(favorite.ID)
+	var limitErr *LimitError
+	if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &limitErr) {
+		t.Errorf("PayFromFavorite(): want LimitError, got %v", err)
+		return
+	}
+	if limitErr.Usage.Remaining != 2_000_00 || limitErr.Usage.Limit.Category != "fun" {
+		t.Errorf("LimitError: want 200000 remaining on fun, got %+v", limitErr.Usage)
+	}
+	if account.Balance != 97_000_00 {
+		t.Errorf("PayFromFavorite(): rejected payment must not debit, balance %v", account.Balance)
+	}
+
+	//другие категории ограничены только суточным лимитом
+	if _, err := s.Pay(account.ID, 5_000_00, "auto"); err != nil {
+		t.Errorf("Pay(auto): error = %v", err)
+		return
+	}
+	if _, err := s.Repeat(first.ID); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Repeat(): want ErrLimitExceeded, got %v", err)
+		return
+	}
+
+	//отменённый платёж возвращает лимит
+	if err := s.Reject(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	usages, err := s.LimitUsage(account.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usages) != 2 || usages[0].Used != 0 || usages[0].Remaining != 5_000_00 || usages[1].Used != 5_000_00 {
+		t.Errorf("LimitUsage(): want fun 0/500000 and daily 500000 used, got %+v", usages)
+	}
+
+	//новый календарный месяц обнуляет месячный лимит, а скользящие сутки - нет
+	if _, err := s.Pay(account.ID, 3_000_00, "fun"); err != nil {
+		t.Fatal(err)
+	}
+	now = time.Date(2020, 12, 1, 9, 0, 0, 0, time.UTC)
+	usages, _ = s.LimitUsage(account.ID)
+	if usages[0].Used != 0 || usages[1].Used != 8_000_00 {
+		t.Errorf("LimitUsage() next month: want fun 0 and daily 800000, got %+v", usages)
+	}
+	now = now.Add(2 * time.Hour)
+	usages, _ = s.LimitUsage(account.ID)
+	if usages[1].Used != 0 {
+		t.Errorf("LimitUsage() next day: want daily 0, got %+v", usages[1])
+	}
+}
+
+func TestService_SetLimit(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := Limit{AccountID: account.ID, Category: "fun", Period: LimitMonthly, Amount: 100}
+	if err := s.SetLimit(limit); err != nil {
+		t.Fatal(err)
+	}
+	limit.Amount = 200
+	if err := s.SetLimit(limit); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.limits) != 1 || s.limits[0].Amount != 200 {
+		t.Errorf("SetLimit(): want limit replaced, got %v", s.limits)
+	}
+
+	invalid := []struct {
+		limit Limit
+		want  error
+	}{
+		{Limit{AccountID: account.ID, Period: LimitDaily}, ErrAmountMustBePositive},
+		{Limit{AccountID: account.ID, Period: "week", Amount: 1}, ErrInvalidLimit},
+		{Limit{AccountID: 42, Period: LimitDaily, Amount: 1}, ErrAccountNotFound},
+	}
+	for _, test := range invalid {
+		if err := s.SetLimit(test.limit); !errors.Is(err, test.want) {
+			t.Errorf("SetLimit(%v): want %v, got %v", test.limit, test.want, err)
+		}
+	}
+
+	if !s.RemoveLimit(Limit{AccountID: account.ID, Category: "fun", Period: LimitMonthly}) || len(s.limits) != 0 {
+		t.Errorf("RemoveLimit(): want limit removed, got %v", s.limits)
+	}
+	if s.RemoveLimit(limit) {
+		t.Errorf("RemoveLimit(): want false for missing limit")
+	}
+}
+
+func TestService_limits_persisted(t *testing.T) {
+	s := newTestService()
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := []Limit{
+		{AccountID: account.ID, Period: LimitDaily, Rolling: true, Amount: 500_00},
+		{AccountID: account.ID, Category: "fun; games", Period: LimitMonthly, Amount: 1_000_00},
+	}
+	for _, limit := range limits {
+		if err := s.SetLimit(limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, format := range formats {
+		dir := t.TempDir()
+		if err := s.Export(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Export(%v): error = %v", format, err)
+		}
+		restored := newTestService()
+		if err := restored.Import(dir, WithFormat(format)); err != nil {
+			t.Fatalf("Import(%v): error = %v", format, err)
+		}
+		if !reflect.DeepEqual(restored.limits, limits) {
+			t.Errorf("Import(%v): want limits %v got %v", format, limits, restored.limits)
+		}
+
+		//повторный импорт заменяет лимиты с тем же ключом, а не добавляет их
+		var summary ImportSummary
+		if err := restored.Import(dir, WithFormat(format), WithImportSummary(&summary)); err != nil {
+			t.Fatal(err)
+		}
+		if len(restored.limits) != 2 || summary.Limits != (MergeCounts{Skipped: 2}) {
+			t.Errorf("Import(%v) twice: want 2 limits skipped, got %v, %+v", format, restored.limits, summary.Limits)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package wallet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrManifestMismatch = errors.New("export does not match manifest")
+var ErrManifestNotFound = errors.New("manifest not found")
+
+//ManifestPolicy определяет, как Import проверяет манифест выгрузки
+type ManifestPolicy int
+
+//Политики проверки манифеста
+const (
+	ManifestVerify  ManifestPolicy = iota // проверять, если манифест есть, и отказывать при расхождениях
+	ManifestRequire                       // отказывать и при отсутствии манифеста
+	ManifestReport                        // записывать расхождения в лог и продолжать импорт
+	ManifestIgnore                        // не читать манифест
+)
+
+//WithManifestPolicy выбирает проверку манифеста при Import, по умолчанию ManifestVerify
+func WithManifestPolicy(policy ManifestPolicy) Option {
+	return func(o *options) {
+		o.manifest = policy
+	}
+}
+
+//Manifest описывает файлы, записанные одним вызовом Export
+type Manifest struct {
+	Format string          `json:"format"`
+	Files  []ManifestEntry `json:"files"`
+}
+
+//ManifestEntry - число записей и SHA-256 содержимого файла выгрузки
+type ManifestEntry struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+//ManifestMismatch - расхождение файла с манифестом
+type ManifestMismatch struct {
+	File    string
+	Problem string
+}
+
+//ManifestError перечисляет все расхождения выгрузки с манифестом
+type ManifestError struct {
+	Dir        string
+	Mismatches []ManifestMismatch
+}
+
+func (e *ManifestError) Error() string {
+	problems := make([]string, 0, len(e.Mismatches))
+	for _, mismatch := range e.Mismatches {
+		problems = append(problems, mismatch.File+": "+mismatch.Problem)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Dir, ErrManifestMismatch, strings.Join(problems, "; "))
+}
+
+func (e *ManifestError) Is(target error) bool {
+	return target == ErrManifestMismatch
+}
+
+//manifestName возвращает имя файла манифеста для формата: manifest-dump.json
+func manifestName(format Format) string {
+	return "manifest-" + format.String() + ".json"
+}
+
+func writeManifest(dir string, format Format, manifest *Manifest) error {
+	_, err := writeFile(filepath.Join(dir, manifestName(format)), manifest.encode)
+	return err
+}
+
+func (m *Manifest) encode(w io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+//exportSections пишет непустые секции snap через create, который создаёт файл
+//name и возвращает SHA-256 записанного, и возвращает манифест этих файлов
+func exportSections(ctx context.Context, snap *snapshot, o options, create func(name string, write func(w io.Writer) error) (string, error)) (*Manifest, error) {
+	manifest := &Manifest{Format: o.format.String()}
+	for _, sec := range sections {
+		if sec.count(snap) == 0 {
+			continue
+		}
+
+		sec := sec
+		name := sec.name + o.format.ext()
+		sum, err := create(name, func(w io.Writer) error {
+			return encodeTo(w, o.keys, func(w io.Writer) error {
+				return encodeSection(ctx, w, o.format, sec, snap)
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Name:    name,
+			Records: sec.count(snap),
+			SHA256:  sum,
+		})
+	}
+	return manifest, nil
+}
+
+//readManifest читает манифест формата format. Возвращает nil, nil, если его нет
+func readManifest(dir string, format Format) (*Manifest, error) {
+	file, err := os.Open(filepath.Join(dir, manifestName(format)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeManifest(file, format)
+}
+
+//maxManifestSize ограничивает размер манифеста, читаемого в память
+const maxManifestSize = 1 << 20
+
+func decodeManifest(r io.Reader, format Format) (*Manifest, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestName(format), err)
+	}
+	return manifest, nil
+}
+
+//entry возвращает запись манифеста о файле name. У nil-манифеста записей нет
+func (m *Manifest) entry(name string) (ManifestEntry, bool) {
+	if m == nil {
+		return ManifestEntry{}, false
+	}
+	for _, entry := range m.Files {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+//VerifyDir проверяет выгрузку в dir по её манифесту: наличие файлов, их
+//контрольные суммы и число записей. Формат выбирается опцией WithFormat.
+//Расхождения возвращаются как *ManifestError
+func VerifyDir(dir string, opts ...Option) error {
+	return VerifyDirContext(context.Background(), dir, opts...)
+}
+
+func VerifyDirContext(ctx context.Context, dir string, opts ...Option) error {
+	o := newOptions(opts)
+	o.manifest = ManifestRequire
+	_, err := readDir(ctx, dir, o)
+	return err
+}
+
+//readDir читает все секции выгрузки в снапшот, сверяя их с манифестом по политике o.manifest
+func readDir(ctx context.Context, dir string, o options) (*snapshot, error) {
+	snap, mismatches, err := scanDir(ctx, dir, o, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMismatches(dir, mismatches, o); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+//checkMismatches возвращает расхождения с манифестом как *ManifestError или,
+//при политике ManifestReport, записывает их в лог
+func checkMismatches(dir string, mismatches []ManifestMismatch, o options) error {
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	manifestErr := &ManifestError{Dir: dir, Mismatches: mismatches}
+	if o.manifest != ManifestReport {
+		return manifestErr
+	}
+	log.Print(manifestErr)
+	return nil
+}
+
+//onSectionRecord получает каждую запись секции с File - путём к её файлу
+type onSectionRecord func(sec section, record *ParseError) error
+
+//scanDir читает все секции выгрузки в снапшот и возвращает расхождения с манифестом
+func scanDir(ctx context.Context, dir string, o options, onRecord onSectionRecord) (*snapshot, []ManifestMismatch, error) {
+	var manifest *Manifest
+	if o.manifest != ManifestIgnore {
+		var err error
+		manifest, err = readManifest(dir, o.format)
+		if err != nil {
+			return nil, nil, err
+		}
+		if manifest == nil && o.manifest == ManifestRequire {
+			return nil, nil, fmt.Errorf("%s: %w", dir, ErrManifestNotFound)
+		}
+	}
+
+	snap := &snapshot{}
+	files := make(map[string]sectionFile)
+	for _, sec := range sections {
+		name := sec.name + o.format.ext()
+		path := filepath.Join(dir, name)
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			if _, listed := manifest.entry(name); !listed {
+				log.Printf("There is no %s file", path)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files[name], err = readSection(ctx, file, path, sec, snap, o, onRecord)
+		if cerr := file.Close(); cerr != nil {
+			log.Print(cerr)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	mismatches, err := checkSections(manifest, files, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, mismatches, nil
+}
+
+//sectionFile - прочитанный файл секции для сверки с манифестом
+type sectionFile struct {
+	path    string
+	sum     string
+	records int // -1, если файл не разобран
+	err     error
+}
+
+//readSection читает файл секции из r в snap. Ошибка содержимого файла
+//возвращается в sectionFile, чтобы сначала сверить файл с манифестом
+func readSection(ctx context.Context, r io.Reader, path string, sec section, snap *snapshot, o options, onRecord onSectionRecord) (sectionFile, error) {
+	//записи с ошибками разбора не попадают в снапшот, но входят в манифест
+	failed := 0
+	var visitRecord recordFunc
+	if onRecord != nil {
+		visitRecord = func(record *ParseError) error {
+			record.File = path
+			if record.Err != nil {
+				failed++
+			}
+			return onRecord(sec, record)
+		}
+	}
+
+	hasher := sha256.New()
+	before := sec.count(snap)
+	content, err := decodeFrom(io.TeeReader(r, hasher), o.keys)
+	if err == nil {
+		err = decodeSection(ctx, content, o.format, sec, snap, visitRecord)
+	}
+	if ctx.Err() != nil {
+		return sectionFile{}, ctx.Err()
+	}
+	//остаток файла, не прочитанный декодером, тоже входит в контрольную сумму
+	if _, cerr := io.Copy(hasher, r); err == nil {
+		err = cerr
+	}
+
+	file := sectionFile{
+		path:    path,
+		sum:     hex.EncodeToString(hasher.Sum(nil)),
+		records: sec.count(snap) - before + failed,
+		err:     err,
+	}
+	if err != nil {
+		file.records = -1
+	}
+	return file, nil
+}
+
+//checkSections сверяет прочитанные файлы секций с манифестом и возвращает
+//расхождения или ошибку первого файла, который не разобран и совпал с манифестом
+//или проверяется по политике ManifestReport
+func checkSections(manifest *Manifest, files map[string]sectionFile, o options) ([]ManifestMismatch, error) {
+	var mismatches []ManifestMismatch
+	for _, sec := range sections {
+		name := sec.name + o.format.ext()
+		entry, listed := manifest.entry(name)
+
+		file, found := files[name]
+		if !found {
+			if listed {
+				mismatches = append(mismatches, ManifestMismatch{File: name, Problem: "file is missing"})
+			}
+			continue
+		}
+
+		if manifest != nil {
+			if mismatch, ok := compareEntry(name, entry, listed, file.sum, file.records); ok {
+				mismatches = append(mismatches, mismatch)
+				//при ManifestReport расхождение только пишется в лог, поэтому
+				//неразобранный файл всё равно отклоняет Import
+				if file.err == nil || o.manifest != ManifestReport {
+					continue
+				}
+			}
+		}
+		if file.err != nil {
+			var parseErr *ParseError
+			if errors.As(file.err, &parseErr) {
+				parseErr.File = file.path
+				return nil, file.err
+			}
+			return nil, fmt.Errorf("%s: %w", file.path, file.err)
+		}
+	}
+	return mismatches, nil
+}
+
+//compareEntry сверяет прочитанный файл с записью манифеста. records < 0 - файл не разобран
+func compareEntry(name string, entry ManifestEntry, listed bool, sum string, records int) (ManifestMismatch, bool) {
+	if !listed {
+		return ManifestMismatch{File: name, Problem: "file is not listed in manifest"}, true
+	}
+
+	if sum != entry.SHA256 {
+		return ManifestMismatch{File: name, Problem: fmt.Sprintf("sha256 %s, want %s", sum, entry.SHA256)}, true
+	}
+	if records >= 0 && records != entry.Records {
+		return ManifestMismatch{File: name, Problem: fmt.Sprintf("%d records, want %d", records, entry.Records)}, true
+	}
+	return ManifestMismatch{}, false
+}
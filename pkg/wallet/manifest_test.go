@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func exportTestDir(t *testing.T, opts ...Option) string {
+	t.Helper()
+
+	s := newTestService()
+	if _, _, _, err := s.addAccount(defaultTestAccount); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.addAccount(testAccount{phone: "+992901000877", balance: 1_000_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Export(dir, opts...); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Export(): error = %v", err)
+	}
+	return dir
+}
+
+func TestVerifyDir_success(t *testing.T) {
+	for _, format := range formats {
+		dir := exportTestDir(t, WithFormat(format))
+		defer os.RemoveAll(dir)
+
+		if err := VerifyDir(dir, WithFormat(format)); err != nil {
+			t.Errorf("VerifyDir(%v): error = %v", format, err)
+		}
+	}
+}
+
+func TestVerifyDir_notFound(t *testing.T) {
+	err := VerifyDir(filepath.Join("testdata", "dump", "v1"))
+	if !errors.Is(err, ErrManifestNotFound) {
+		t.Errorf("VerifyDir(): must return ErrManifestNotFound, returned = %v", err)
+		return
+	}
+}
+
+func TestService_Import_truncatedFile(t *testing.T) {
+	dir := exportTestDir(t)
+	defer os.RemoveAll(dir)
+
+	//обрезаем последнюю запись accounts.dump
+	path := filepath.Join(dir, "accounts.dump")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := bytes.LastIndexByte(data[:len(data)-1], '\n') + 1
+	if err := ioutil.WriteFile(path, data[:last], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifestErr *ManifestError
+	err = VerifyDir(dir)
+	if !errors.As(err, &manifestErr) || len(manifestErr.Mismatches) != 1 || manifestErr.Mismatches[0].File != "accounts.dump" {
+		t.Errorf("VerifyDir(): must report accounts.dump, returned = %v", err)
+		return
+	}
+
+	s := newTestService()
+	err = s.Import(dir)
+	if !errors.Is(err, ErrManifestMismatch) {
+		t.Errorf("Import(): must return ErrManifestMismatch, returned = %v", err)
+		return
+	}
+	if len(s.accounts) != 0 || len(s.payments) != 0 {
+		t.Errorf("Import(): service changed on manifest mismatch")
+		return
+	}
+
+	//в режиме отчёта импорт продолжается
+	err = s.Import(dir, WithManifestPolicy(ManifestReport))
+	if err != nil {
+		t.Errorf("Import(ManifestReport): error = %v", err)
+		return
+	}
+	if len(s.accounts) != 1 {
+		t.Errorf("Import(ManifestReport): want 1 account, got %v", len(s.accounts))
+		return
+	}
+}
+
+func TestService_Import_corruptedFileReport(t *testing.T) {
+	dir := exportTestDir(t)
+	defer os.RemoveAll(dir)
+
+	//дописанная строка меняет контрольную сумму и не разбирается
+	path := filepath.Join(dir, "accounts.dump")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString("3;+992901000878;abc;\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService()
+	err = s.Import(dir, WithManifestPolicy(ManifestReport))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != path || parseErr.Line != 4 {
+		t.Errorf("Import(ManifestReport): must return ParseError at %s:4, returned = %v", path, err)
+	}
+	if len(s.accounts) != 0 {
+		t.Errorf("Import(ManifestReport): want no accounts imported, got %v", len(s.accounts))
+	}
+
+	if err := s.Import(dir); !errors.Is(err, ErrManifestMismatch) {
+		t.Errorf("Import(): must return ErrManifestMismatch, returned = %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+var ErrMergeConflict = errors.New("imported record conflicts with existing one")
+
+//MergeStrategy определяет, что Import делает с записью, ID которой уже есть в сервисе
+type MergeStrategy int
+
+//Стратегии слияния при Import. Совпадающие записи всегда пропускаются
+const (
+	MergeOverwrite    MergeStrategy = iota // заменять существующую запись импортированной
+	MergeKeepExisting                      // оставлять существующую запись
+	MergeFail                              // отказывать в импорте при первом расхождении
+	MergeNewest                            // оставлять запись с более поздним Updated
+)
+
+//WithMergeStrategy выбирает стратегию слияния при Import, по умолчанию MergeOverwrite
+func WithMergeStrategy(strategy MergeStrategy) Option {
+	return func(o *options) {
+		o.merge = strategy
+	}
+}
+
+//WithImportSummary записывает в summary итоги слияния при успешном Import
+func WithImportSummary(summary *ImportSummary) Option {
+	return func(o *options) {
+		o.summary = summary
+	}
+}
+
+//MergeCounts - число добавленных, заменённых и пропущенных записей одного типа
+type MergeCounts struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+}
+
+//ImportSummary - итоги слияния выгрузки с записями сервиса
+type ImportSummary struct {
+	Accounts  MergeCounts `json:"accounts"`
+	Payments  MergeCounts `json:"payments"`
+	Favorites MergeCounts `json:"favorites"`
+	Entries   MergeCounts `json:"entries"`
+	Attempts  MergeCounts `json:"fraudAttempts"`
+	Accruals  MergeCounts `json:"accruals"`
+	Limits    MergeCounts `json:"limits"`
+	Budgets   MergeCounts `json:"budgets"`
+}
+
+func (s ImportSummary) String() string {
+	return fmt.Sprintf("accounts %+v, payments %+v, favorites %+v, entries %+v, fraud attempts %+v, accruals %+v, limits %+v, budgets %+v",
+		s.Accounts, s.Payments, s.Favorites, s.Entries, s.Attempts, s.Accruals, s.Limits, s.Budgets)
+}
+
+//replace решает, заменить ли существующую запись импортированной
+func (m MergeStrategy) replace(existing, imported time.Time, equal bool) (bool, error) {
+	if equal {
+		return false, nil
+	}
+
+	switch m {
+	case MergeKeepExisting:
+		return false, nil
+	case MergeFail:
+		return false, ErrMergeConflict
+	case MergeNewest:
+		return imported.After(existing), nil
+	default:
+		return true, nil
+	}
+}
+
+//count учитывает решение о записи в counts
+func (c *MergeCounts) count(found bool, replace bool) {
+	switch {
+	case !found:
+		c.Inserted++
+	case replace:
+		c.Updated++
+	default:
+		c.Skipped++
+	}
+}
+
+//merge добавляет записи снапшота в сервис, разрешая совпадения ID стратегией
+//strategy. Сначала принимаются все решения, поэтому при ошибке сервис не меняется
+func (s *Service) merge(snap *snapshot, strategy MergeStrategy) (ImportSummary, error) {
+	var summary ImportSummary
+	var changes []func()
+
+	accounts := make(map[int64]*types.Account, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts[account.ID] = account
+	}
+	for _, imported := range snap.accounts {
+		imported := imported
+		existing, found := accounts[imported.ID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Updated, imported.Updated, *existing == *imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: account %d", err, imported.ID)
+			}
+		}
+		summary.Accounts.count(found, replace)
+
+		switch {
+		case !found:
+			accounts[imported.ID] = imported
+			changes = append(changes, func() {
+				s.accounts = append(s.accounts, imported)
+				s.track("account", strconv.FormatInt(imported.ID, 10), nil, *imported)
+			})
+		case replace:
+			changes = append(changes, func() {
+				before := *existing
+				*existing = *imported
+				s.track("account", strconv.FormatInt(existing.ID, 10), before, *existing)
+			})
+		}
+	}
+
+	payments := make(map[string]*types.Payment, len(s.payments))
+	for _, payment := range s.payments {
+		payments[payment.ID] = payment
+	}
+	for _, imported := range snap.payments {
+		imported := imported
+		existing, found := payments[imported.ID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Updated, imported.Updated, *existing == *imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: payment %s", err, imported.ID)
+			}
+		}
+		summary.Payments.count(found, replace)
+
+		switch {
+		case !found:
+			payments[imported.ID] = imported
+			changes = append(changes, func() {
+				s.payments = append(s.payments, imported)
+				s.track("payment", imported.ID, nil, *imported)
+			})
+		case replace:
+			changes = append(changes, func() {
+				before := *existing
+				*existing = *imported
+				s.track("payment", existing.ID, before, *existing)
+			})
+		}
+	}
+
+	favorites := make(map[string]*types.Favorite, len(s.favorites))
+	for _, favorite := range s.favorites {
+		favorites[favorite.ID] = favorite
+	}
+	for _, imported := range snap.favorites {
+		imported := imported
+		existing, found := favorites[imported.ID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Updated, imported.Updated, *existing == *imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: favorite %s", err, imported.ID)
+			}
+		}
+		summary.Favorites.count(found, replace)
+
+		switch {
+		case !found:
+			favorites[imported.ID] = imported
+			changes = append(changes, func() {
+				s.favorites = append(s.favorites, imported)
+				s.track("favorite", imported.ID, nil, *imported)
+			})
+		case replace:
+			changes = append(changes, func() {
+				before := *existing
+				*existing = *imported
+				s.track("favorite", existing.ID, before, *existing)
+			})
+		}
+	}
+
+	//проводки не меняются после создания, поэтому сравниваются по времени создания
+	entries := make(map[string]*types.Entry, len(s.entries))
+	for _, entry := range s.entries {
+		entries[entry.ID] = entry
+	}
+	for _, imported := range snap.entries {
+		imported := imported
+		existing, found := entries[imported.ID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Created, imported.Created, *existing == *imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: entry %s", err, imported.ID)
+			}
+		}
+		summary.Entries.count(found, replace)
+
+		switch {
+		case !found:
+			entries[imported.ID] = imported
+			changes = append(changes, func() {
+				s.entries = append(s.entries, imported)
+				s.track("entry", imported.ID, nil, *imported)
+			})
+		case replace:
+			changes = append(changes, func() {
+				before := *existing
+				*existing = *imported
+				s.track("entry", existing.ID, before, *existing)
+			})
+		}
+	}
+
+	//попытки тоже не меняются после записи
+	attempts := make(map[string]FraudAttempt, len(s.fraudAttempts))
+	for _, attempt := range s.fraudAttempts {
+		attempts[attempt.ID] = attempt
+	}
+	for _, imported := range snap.attempts {
+		imported := imported
+		existing, found := attempts[imported.ID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Time, imported.Time, existing == imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: fraud attempt %s", err, imported.ID)
+			}
+		}
+		summary.Attempts.count(found, replace)
+
+		switch {
+		case !found:
+			attempts[imported.ID] = imported
+			changes = append(changes, func() {
+				s.fraudAttempts = append(s.fraudAttempts, imported)
+				s.track("fraud_attempt", imported.ID, nil, imported)
+			})
+		case replace:
+			attempts[imported.ID] = imported
+			changes = append(changes, func() {
+				for i, before := range s.fraudAttempts {
+					if before.ID == imported.ID {
+						s.fraudAttempts[i] = imported
+						s.track("fraud_attempt", imported.ID, before, imported)
+					}
+				}
+			})
+		}
+	}
+
+	//состояние начисления меняется ежедневно, новее то, что начислено дальше
+	accruals := make(map[int64]*accrual, len(s.accruals))
+	for id, state := range s.accruals {
+		accruals[id] = state
+	}
+	for _, imported := range snap.accruals {
+		imported := imported
+		existing, found := accruals[imported.AccountID]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(existing.Through, imported.Through, existing.equal(imported))
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: accrual of account %d", err, imported.AccountID)
+			}
+		}
+		summary.Accruals.count(found, replace)
+
+		if !found || replace {
+			accruals[imported.AccountID] = imported
+			changes = append(changes, func() {
+				if s.accruals == nil {
+					s.accruals = make(map[int64]*accrual)
+				}
+				s.accruals[imported.AccountID] = imported
+			})
+		}
+	}
+
+	//лимит определяют счёт, категория и период, времени изменения у него нет,
+	//поэтому MergeNewest оставляет существующий
+	limits := make(map[Limit]Limit, len(s.limits))
+	for _, limit := range s.limits {
+		limits[limit.key()] = limit
+	}
+	for _, imported := range snap.limits {
+		imported := imported
+		existing, found := limits[imported.key()]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(time.Time{}, time.Time{}, existing == imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: limit %v of account %d", err, imported, imported.AccountID)
+			}
+		}
+		summary.Limits.count(found, replace)
+
+		if !found || replace {
+			limits[imported.key()] = imported
+			changes = append(changes, func() {
+				s.putLimit(imported)
+			})
+		}
+	}
+
+	//бюджеты, как и лимиты, без времени изменения
+	budgets := make(map[Budget]Budget, len(s.budgets))
+	for _, budget := range s.budgets {
+		budgets[budget.key()] = budget
+	}
+	for _, imported := range snap.budgets {
+		imported := imported
+		existing, found := budgets[imported.key()]
+		replace := false
+		if found {
+			var err error
+			replace, err = strategy.replace(time.Time{}, time.Time{}, existing == imported)
+			if err != nil {
+				return ImportSummary{}, fmt.Errorf("%w: budget %s of account %d", err, imported.Category, imported.AccountID)
+			}
+		}
+		summary.Budgets.count(found, replace)
+
+		if !found || replace {
+			budgets[imported.key()] = imported
+			changes = append(changes, func() {
+				s.putBudget(imported)
+			})
+		}
+	}
+
+	for _, change := range changes {
+		change()
+	}
+	for _, account := range snap.accounts {
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
+	}
+	return summary, nil
+}
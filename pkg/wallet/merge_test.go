@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//tickingClock возвращает часы, которые сдвигаются на секунду при каждом вызове
+func tickingClock() func() time.Time {
+	now := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func TestService_Import_mergeStrategies(t *testing.T) {
+	tests := []struct {
+		strategy MergeStrategy
+		balance  types.Money
+		want     ImportSummary
+		err      error
+	}{
+		{strategy: MergeOverwrite, balance: 0, want: ImportSummary{
+			Accounts:  MergeCounts{Updated: 1},
+			Payments:  MergeCounts{Skipped: 1},
+			Favorites: MergeCounts{Skipped: 1},
+			Entries:   MergeCounts{Skipped: 1},
+		}},
+		{strategy: MergeKeepExisting, balance: 5_000_00, want: ImportSummary{
+			Accounts:  MergeCounts{Skipped: 1},
+			Payments:  MergeCounts{Skipped: 1},
+			Favorites: MergeCounts{Skipped: 1},
+			Entries:   MergeCounts{Skipped: 1},
+		}},
+		{strategy: MergeNewest, balance: 5_000_00, want: ImportSummary{
+			Accounts:  MergeCounts{Skipped: 1},
+			Payments:  MergeCounts{Skipped: 1},
+			Favorites: MergeCounts{Skipped: 1},
+			Entries:   MergeCounts{Skipped: 1},
+		}},
+		{strategy: MergeFail, balance: 5_000_00, err: ErrMergeConflict},
+	}
+
+	for _, test := range tests {
+		s := newTestService()
+		s.SetClock(tickingClock())
+		account, _, _, err := s.addAccount(defaultTestAccount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		if err := s.Export(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		//счёт в сервисе изменён после выгрузки
+		if err := s.Deposit(account.ID, 5_000_00); err != nil {
+			t.Fatal(err)
+		}
+		accounts := len(s.accounts)
+
+		var summary ImportSummary
+		err = s.Import(dir, WithMergeStrategy(test.strategy), WithImportSummary(&summary))
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("Import(%v): must return %v, returned = %v", test.strategy, test.err, err)
+			}
+			if len(s.accounts) != accounts || account.Balance != test.balance {
+				t.Errorf("Import(%v): service changed on error", test.strategy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Import(%v): error = %v", test.strategy, err)
+			continue
+		}
+
+		if summary != test.want {
+			t.Errorf("Import(%v): want summary %v, got %v", test.strategy, test.want, summary)
+		}
+		if account.Balance != test.balance {
+			t.Errorf("Import(%v): want balance %v, got %v", test.strategy, test.balance, account.Balance)
+		}
+	}
+}
+
+func TestService_Import_mergeNewestUpdates(t *testing.T) {
+	s := newTestService()
+	s.SetClock(tickingClock())
+	account, _, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := *account
+
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := s.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	//сервис со старой версией счёта получает более новую
+	stale := newTestService()
+	stale.accounts = []*types.Account{&old}
+	stale.nextAccountID = old.ID
+
+	var summary ImportSummary
+	if err := stale.Import(dir, WithMergeStrategy(MergeNewest), WithImportSummary(&summary)); err != nil {
+		t.Errorf("Import(): error = %v", err)
+		return
+	}
+	want := ImportSummary{
+		Accounts:  MergeCounts{Updated: 1},
+		Payments:  MergeCounts{Inserted: 1},
+		Favorites: MergeCounts{Inserted: 1},
+		Entries:   MergeCounts{Inserted: 2}, // оба пополнения
+	}
+	if summary != want || stale.accounts[0].Balance != account.Balance {
+		t.Errorf("Import(): newer account must replace older one, summary %v", summary)
+		return
+	}
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//DumpVersion - версия, в которой Export пишет файлы .dump
+const DumpVersion = 7
+
+//escapedDumpVersion - первая версия, в которой поля дампа экранируются, см. escapeField
+const escapedDumpVersion = 4
+
+//dumpHeaderPrefix начинает первую строку файла .dump: "#wallet-dump accounts 2".
+//Файлы без заголовка считаются версией 1
+const dumpHeaderPrefix = "#wallet-dump"
+
+var ErrUnsupportedVersion = errors.New("unsupported dump version")
+
+//migration переводит поля одной записи на следующую версию
+type migration func(fields []string) ([]string, error)
+
+//migrations[section][from] переводит запись секции из версии from в from+1.
+//При изменении формата записей DumpVersion увеличивается и сюда добавляется шаг
+//для каждой секции, а в testdata - образцы файлов новой версии
+var migrations = map[string]map[int]migration{
+	"accounts": {
+		1: keepFields, // v2 добавила заголовок, записи не менялись
+		2: insertField(3, "0"), // v3 добавила время изменения, 0 - не известно
+		3: keepFields,          // v4 экранирует поля, см. splitDumpFields
+		4: insertField(4, "0"), // v5 добавила время создания, 0 - не известно
+		5: insertField(5, "0"), // v6 добавила бонусный баланс
+		6: keepFields,
+	},
+	"payments": {
+		1: keepFields,
+		2: insertField(5, "0"),
+		3: keepFields,
+		4: insertField(6, "0"),
+		5: keepFields,
+		6: insertField(7, ""), // v7 добавила избранное, из которого создан платёж
+	},
+	"favorites": {
+		1: keepFields,
+		2: insertField(5, "0"),
+		3: keepFields,
+		4: keepFields,
+		5: keepFields,
+		6: keepFields,
+	},
+	//проводки появились в v6
+	"entries": {
+		6: keepFields,
+	},
+	//попытки платежей, остановленные антифрод-проверкой, выгружаются с v7
+	"fraud_attempts": {},
+	//состояние начисления процентов выгружается с v7
+	"accruals": {},
+	//лимиты платежей выгружаются с v7
+	"limits": {},
+	//месячные бюджеты выгружаются с v7
+	"budgets": {},
+}
+
+func keepFields(fields []string) ([]string, error) {
+	return fields, nil
+}
+
+//insertField возвращает миграцию, вставляющую поле value перед полем index
+func insertField(index int, value string) migration {
+	return func(fields []string) ([]string, error) {
+		if len(fields) < index {
+			return nil, fmt.Errorf("want %d fields, got %d", index, len(fields))
+		}
+		migrated := make([]string, 0, len(fields)+1)
+		migrated = append(migrated, fields[:index]...)
+		migrated = append(migrated, value)
+		return append(migrated, fields[index:]...), nil
+	}
+}
+
+//dumpHeader возвращает заголовок файла секции name в текущей версии
+func dumpHeader(name string) string {
+	return dumpHeaderPrefix + " " + name + " " + strconv.Itoa(DumpVersion)
+}
+
+//parseDumpHeader разбирает заголовок файла секции name. ok=false, если line не заголовок
+func parseDumpHeader(name string, line string) (version int, ok bool, err error) {
+	if !strings.HasPrefix(line, dumpHeaderPrefix) {
+		return 1, false, nil
+	}
+
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[0] != dumpHeaderPrefix {
+		return 0, true, fmt.Errorf("invalid header %q", line)
+	}
+	if parts[1] != name {
+		return 0, true, fmt.Errorf("header is for %q, want %q", parts[1], name)
+	}
+
+	version, err = strconv.Atoi(parts[2])
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid header %q", line)
+	}
+	if version > DumpVersion {
+		return 0, true, fmt.Errorf("%w %d, newest known is %d", ErrUnsupportedVersion, version, DumpVersion)
+	}
+	return version, true, nil
+}
+
+//splitDumpFields делит строку дампа версии version на поля. До
+//escapedDumpVersion поля не экранировались и делятся по каждому ";"
+func splitDumpFields(version int, text string) []string {
+	if version < escapedDumpVersion {
+		return strings.Split(text, ";")
+	}
+	return splitEscaped(text, ';')
+}
+
+//migrateFields переводит поля записи секции name из версии version в DumpVersion
+func migrateFields(name string, version int, fields []string) ([]string, error) {
+	for ; version < DumpVersion; version++ {
+		step, ok := migrations[name][version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration for %s from %d", ErrUnsupportedVersion, name, version)
+		}
+
+		var err error
+		fields, err = step(fields)
+		if err != nil {
+			return nil, fmt.Errorf("migrate from %d: %w", version, err)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//fixtureSnapshot - записи, которые хранят образцы testdata/dump/v*
+func fixtureSnapshot() *snapshot {
+	return &snapshot{
+		accounts: []*types.Account{
+			{ID: 1, Phone: "+992901000876", Balance: 150000},
+			{ID: 2, Phone: "+992901000877", Balance: 0},
+		},
+		payments: []*types.Payment{
+			{ID: "a869fe66-7265-461d-a2a8-6e3dd4061f5d", AccountID: 1, Amount: 200000, Category: "auto", Status: types.PaymentStatusInProgress},
+			{ID: "0b8f2a1e-6c1d-4b7e-9d41-3f5a2c8e7b10", AccountID: 2, Amount: 50000, Category: "food", Status: types.PaymentStatusFail},
+		},
+		favorites: []*types.Favorite{
+			{ID: "daf9820c-0706-4480-932e-bc23c9875d52", AccountID: 1, Name: "My Favorite Payment", Amount: 200000, Category: "auto"},
+		},
+	}
+}
+
+func TestService_Import_historicalVersions(t *testing.T) {
+	current := filepath.Join("testdata", "dump", "v"+strconv.Itoa(DumpVersion))
+
+	for version := 1; version <= DumpVersion; version++ {
+		dir := filepath.Join("testdata", "dump", "v"+strconv.Itoa(version))
+
+		s := newTestService()
+		if err := s.Import(dir); err != nil {
+			t.Errorf("Import(v%d): error = %v", version, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(s.snapshot(), fixtureSnapshot()) {
+			t.Errorf("Import(v%d): want %v got %v", version, fixtureSnapshot(), s.snapshot())
+			continue
+		}
+
+		//после импорта любой версии Export пишет файлы текущей версии
+		out, err := ioutil.TempDir("", "wallet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(out)
+
+		if err := s.Export(out); err != nil {
+			t.Errorf("Export(): error = %v", err)
+			continue
+		}
+		for _, name := range []string{"accounts.dump", "payments.dump", "favorites.dump"} {
+			want, _ := ioutil.ReadFile(filepath.Join(current, name))
+			got, _ := ioutil.ReadFile(filepath.Join(out, name))
+			if string(want) != string(got) {
+				t.Errorf("Export() after v%d: %s want %q got %q", version, name, want, got)
+			}
+		}
+	}
+}
+
+func TestService_Import_invalidHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   error
+	}{
+		{"#wallet-dump accounts " + strconv.Itoa(DumpVersion+1), ErrUnsupportedVersion},
+		{"#wallet-dump payments " + strconv.Itoa(DumpVersion), nil},
+		{"#wallet-dump accounts x", nil},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "wallet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		content := tt.header + "\n1;+992901000876;0;\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "accounts.dump"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		s := newTestService()
+		err = s.Import(dir)
+		if err == nil {
+			t.Errorf("Import(%q): must return error, returned nil", tt.header)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("Import(%q): must return %v, returned = %v", tt.header, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRewardProgram = errors.New("invalid reward program")
+
+//RewardProgram - программа кэшбэка: доля суммы проведённого платежа категории
+//возвращается на бонусный баланс счёта. Ставки задаются в сотых долях процента
+//(500 - 5%), нулевые ограничения не действуют
+type RewardProgram struct {
+	Name       string                        `json:"name"`
+	Rates      map[types.PaymentCategory]int `json:"rates"`
+	PaymentCap types.Money                   `json:"paymentCap,omitempty"` // не больше за один платёж
+	MonthlyCap types.Money                   `json:"monthlyCap,omitempty"` // не больше на счёт за календарный месяц
+	From       time.Time                     `json:"from,omitempty"`       // пусто - без начала
+	Until      time.Time                     `json:"until,omitempty"`      // не включая, пусто - бессрочно
+}
+
+//active сообщает, действует ли программа в момент at
+func (p RewardProgram) active(at time.Time) bool {
+	if !p.From.IsZero() && at.Before(p.From) {
+		return false
+	}
+	return p.Until.IsZero() || at.Before(p.Until)
+}
+
+//reward считает кэшбэк за платёж без учёта месячного ограничения
+func (p RewardProgram) reward(payment *types.Payment) types.Money {
+	reward := payment.Amount * types.Money(p.Rates[payment.Category]) / 10_000
+	if p.PaymentCap > 0 && reward > p.PaymentCap {
+		reward = p.PaymentCap
+	}
+	return reward
+}
+
+func (p RewardProgram) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidRewardProgram)
+	}
+	if len(p.Rates) == 0 {
+		return fmt.Errorf("%w: %s has no rates", ErrInvalidRewardProgram, p.Name)
+	}
+	for category, rate := range p.Rates {
+		if rate <= 0 || rate > 10_000 {
+			return fmt.Errorf("%w: %s rate %d for %s is out of range", ErrInvalidRewardProgram, p.Name, rate, category)
+		}
+	}
+	if p.PaymentCap < 0 || p.MonthlyCap < 0 {
+		return fmt.Errorf("%w: %s has negative cap", ErrInvalidRewardProgram, p.Name)
+	}
+	if !p.From.IsZero() && !p.Until.IsZero() && !p.Until.After(p.From) {
+		return fmt.Errorf("%w: %s ends before it starts", ErrInvalidRewardProgram, p.Name)
+	}
+	return nil
+}
+
+//SetRewardProgram добавляет программу кэшбэка, заменяя программу с тем же именем.
+//Программа применяется к платежам, проведённым после её добавления
+func (s *Service) SetRewardProgram(program RewardProgram) error {
+	if err := program.validate(); err != nil {
+		return err
+	}
+
+	for i, existing := range s.rewards {
+		if existing.Name == program.Name {
+			s.rewards[i] = program
+			return nil
+		}
+	}
+	s.rewards = append(s.rewards, program)
+	return nil
+}
+
+//LoadRewardPrograms читает программы кэшбэка из JSON-файла вида
+//{"programs": [{"name": "auto", "rates": {"auto": 500}, "paymentCap": 10000, "from": "2020-11-01T00:00:00Z"}]}
+func LoadRewardPrograms(path string) ([]RewardProgram, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Programs []RewardProgram `json:"programs"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, program := range file.Programs {
+		if err := program.validate(); err != nil {
+			return nil, fmt.Errorf("%s: program %d: %w", path, i+1, err)
+		}
+	}
+	return file.Programs, nil
+}
+
+//RemoveRewardProgram удаляет программу кэшбэка. Начисленный ею кэшбэк остаётся на
+//счетах и списывается при отмене платежей
+func (s *Service) RemoveRewardProgram(name string) bool {
+	for i, existing := range s.rewards {
+		if existing.Name == name {
+			s.rewards = append(s.rewards[:i:i], s.rewards[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//RewardPrograms возвращает действующий набор программ кэшбэка
+func (s *Service) RewardPrograms() []RewardProgram {
+	return append([]RewardProgram(nil), s.rewards...)
+}
+
+//rewarded суммирует кэшбэк программы program, начисленный счёту в [from, to)
+//и не списанный отменой платежа
+func (s *Service) rewarded(accountID int64, program string, from time.Time, to time.Time) types.Money {
+	var total types.Money
+	for _, entry := range s.entries {
+		if entry.AccountID != accountID || entry.Kind != types.EntryCashback || entry.Note != program {
+			continue
+		}
+		if entry.Created.Before(from) || !entry.Created.Before(to) {
+			continue
+		}
+		if s.clawedBack(entry) {
+			continue
+		}
+		total += entry.Amount
+	}
+	return total
+}
+
+//clawedBack сообщает, списан ли уже кэшбэк cashback
+func (s *Service) clawedBack(cashback *types.Entry) bool {
+	for _, entry := range s.entries {
+		if entry.Kind == types.EntryClawback && entry.PaymentID == cashback.PaymentID && entry.Note == cashback.Note {
+			return true
+		}
+	}
+	return false
+}
+
+//creditRewards начисляет кэшбэк за проведённый платёж по программам, действовавшим
+//на момент его создания. Платежи с неизвестным временем создания не вознаграждаются
+func (s *Service) creditRewards(payment *types.Payment) {
+	if payment.Created.IsZero() || len(s.rewards) == 0 {
+		return
+	}
+	account, err := s.FindAccountByID(payment.AccountID)
+	if err != nil {
+		return
+	}
+
+	now := s.now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, program := range s.rewards {
+		if !program.active(payment.Created) {
+			continue
+		}
+		reward := program.reward(payment)
+		if program.MonthlyCap > 0 {
+			left := program.MonthlyCap - s.rewarded(account.ID, program.Name, month, month.AddDate(0, 1, 0))
+			if reward > left {
+				reward = left
+			}
+		}
+		if reward <= 0 {
+			continue
+		}
+
+		entry := &types.Entry{
+			ID:        uuid.New().String(),
+			AccountID: account.ID,
+			Kind:      types.EntryCashback,
+			Amount:    reward,
+			PaymentID: payment.ID,
+			Note:      program.Name,
+			Created:   now,
+		}
+		s.addBonus(account, entry, reward, now)
+	}
+}
+
+//clawbackRewards списывает с бонусного баланса кэшбэк отменённого платежа
+func (s *Service) clawbackRewards(payment *types.Payment) {
+	account, err := s.FindAccountByID(payment.AccountID)
+	if err != nil {
+		return
+	}
+
+	now := s.now()
+	for _, cashback := range s.entries {
+		if cashback.PaymentID != payment.ID || cashback.Kind != types.EntryCashback || s.clawedBack(cashback) {
+			continue
+		}
+
+		entry := &types.Entry{
+			ID:        uuid.New().String(),
+			AccountID: account.ID,
+			Kind:      types.EntryClawback,
+			Amount:    cashback.Amount,
+			PaymentID: payment.ID,
+			Note:      cashback.Note,
+			Created:   now,
+		}
+		s.addBonus(account, entry, -cashback.Amount, now)
+	}
+}
+
+//addBonus записывает проводку entry и изменяет бонусный баланс счёта на delta
+func (s *Service) addBonus(account *types.Account, entry *types.Entry, delta types.Money, now time.Time) {
+	before := *account
+	account.Bonus += delta
+	account.Updated = now
+	s.entries = append(s.entries, entry)
+	s.track("account", strconv.FormatInt(account.ID, 10), before, *account)
+	s.track("entry", entry.ID, nil, *entry)
+}
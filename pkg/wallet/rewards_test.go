@@ -0,0 +1,175 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestService_rewards(t *testing.T) {
+	now := time.Date(2020, 11, 10, 12, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetRewardProgram(RewardProgram{
+		Name:       "auto 5%",
+		Rates:      map[types.PaymentCategory]int{"auto": 500},
+		PaymentCap: 30_00,
+		MonthlyCap: 50_00,
+		From:       time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC),
+		Until:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//кэшбэк начисляется при проведении, а не при создании платежа
+	first, err := s.Pay(account.ID, 400_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Bonus != 0 {
+		t.Errorf("Pay(): want no bonus before confirm, got %v", account.Bonus)
+	}
+	if err := s.Confirm(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != types.PaymentStatusOk || account.Bonus != 20_00 {
+		t.Errorf("Confirm(): want OK and bonus 2000, got %v and %v", first.Status, account.Bonus)
+	}
+	if err := s.Confirm(first.ID); !errors.Is(err, ErrPaymentNotInProgress) {
+		t.Errorf("Confirm() twice: want ErrPaymentNotInProgress, got %v", err)
+	}
+
+	//5% от 100000 ограничены 3000 за платёж - ровно столько осталось до месячного лимита
+	second, err := s.Pay(account.ID, 1_000_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.Pay(account.ID, 1_000_00, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payment := range []*types.Payment{second, food} {
+		if err := s.Confirm(payment.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if account.Bonus != 50_00 {
+		t.Errorf("Confirm(): want bonus capped at 5000, got %v", account.Bonus)
+	}
+
+	//отмена списывает кэшбэк и освобождает месячный лимит
+	if err := s.Reject(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Bonus != 30_00 {
+		t.Errorf("Reject(): want bonus 3000, got %v", account.Bonus)
+	}
+	third, err := s.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Confirm(third.ID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Bonus != 35_00 {
+		t.Errorf("Confirm() after Reject(): want bonus 3500, got %v", account.Bonus)
+	}
+
+	entries := s.Entries()
+	kinds := []types.EntryKind{types.EntryCashback, types.EntryCashback, types.EntryClawback, types.EntryCashback}
+	if len(entries) != len(kinds) {
+		t.Fatalf("Entries(): want %d entries, got %v", len(kinds), entries)
+	}
+	for i, kind := range kinds {
+		if entries[i].Kind != kind || entries[i].Note != "auto 5%" {
+			t.Errorf("Entries()[%d]: want %s of auto 5%%, got %+v", i, kind, entries[i])
+		}
+	}
+	if entries[2].PaymentID != first.ID || entries[2].Amount != 20_00 {
+		t.Errorf("Entries(): want clawback 2000 of %v, got %+v", first.ID, entries[2])
+	}
+
+	//после окончания программы кэшбэк не начисляется
+	now = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	late, err := s.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Confirm(late.ID); err != nil {
+		t.Fatal(err)
+	}
+	if account.Bonus != 35_00 || len(s.Entries()) != len(kinds) {
+		t.Errorf("Confirm() after program end: want no cashback, got bonus %v", account.Bonus)
+	}
+}
+
+func TestService_SetRewardProgram(t *testing.T) {
+	s := newTestService()
+	from := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	invalid := []RewardProgram{
+		{Rates: map[types.PaymentCategory]int{"auto": 500}},
+		{Name: "empty"},
+		{Name: "zero", Rates: map[types.PaymentCategory]int{"auto": 0}},
+		{Name: "over 100%", Rates: map[types.PaymentCategory]int{"auto": 10_001}},
+		{Name: "negative cap", Rates: map[types.PaymentCategory]int{"auto": 500}, MonthlyCap: -1},
+		{Name: "reversed", Rates: map[types.PaymentCategory]int{"auto": 500}, From: from, Until: from},
+	}
+	for _, program := range invalid {
+		if err := s.SetRewardProgram(program); !errors.Is(err, ErrInvalidRewardProgram) {
+			t.Errorf("SetRewardProgram(%+v): want ErrInvalidRewardProgram, got %v", program, err)
+		}
+	}
+
+	if err := s.SetRewardProgram(RewardProgram{Name: "auto", Rates: map[types.PaymentCategory]int{"auto": 500}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRewardProgram(RewardProgram{Name: "auto", Rates: map[types.PaymentCategory]int{"auto": 300}}); err != nil {
+		t.Fatal(err)
+	}
+	if programs := s.RewardPrograms(); len(programs) != 1 || programs[0].Rates["auto"] != 300 {
+		t.Errorf("SetRewardProgram(): want program replaced, got %v", programs)
+	}
+	if !s.RemoveRewardProgram("auto") || len(s.RewardPrograms()) != 0 {
+		t.Errorf("RemoveRewardProgram(): want program removed, got %v", s.RewardPrograms())
+	}
+}
+
+func TestLoadRewardPrograms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewards.json")
+	data := `{"programs": [{"name": "auto", "rates": {"auto": 500, "fuel": 300}, "paymentCap": 10000, "from": "2020-11-01T00:00:00Z"}]}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	programs, err := LoadRewardPrograms(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RewardProgram{
+		Name:       "auto",
+		Rates:      map[types.PaymentCategory]int{"auto": 5_00, "fuel": 3_00},
+		PaymentCap: 100_00,
+		From:       time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(programs) != 1 || !reflect.DeepEqual(programs[0], want) {
+		t.Errorf("LoadRewardPrograms(): want %+v, got %+v", want, programs)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"programs": [{"name": "empty"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRewardPrograms(path); !errors.Is(err, ErrInvalidRewardProgram) {
+		t.Errorf("LoadRewardPrograms(): want ErrInvalidRewardProgram, got %v", err)
+	}
+}
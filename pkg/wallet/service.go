@@ -2,13 +2,18 @@ package wallet
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
+	"time"
 	"github.com/RAZ-os/wallet/pkg/types"
 	"github.com/google/uuid"
 )
@@ -18,15 +23,45 @@ var ErrAmountMustBePositive = errors.New("amount must be greater than zero")
 var ErrAccountNotFound = errors.New("account not found")
 var ErrPaymentNotFound = errors.New("payment not found")
 var ErrFavoriteNotFound = errors.New("favorite not found")
+var ErrPaymentNotInProgress = errors.New("payment is not in progress")
 
 type Service struct {
 	nextAccountID int64
 	accounts      []*types.Account
 	payments      []*types.Payment
 	favorites     []*types.Favorite
+	entries       []*types.Entry
+	hooks         []Hook
+	fraudRules    []FraudRule
+	fraudAttempts []FraudAttempt
+	limits        []Limit
+	budgets       []Budget
+	rewards       []RewardProgram
+	fees          []Fee
+	interestPlans []InterestPlan
+	accruals      map[int64]*accrual
+	clock         func() time.Time
+	audit         *AuditLog
+	changes       []change
+	subscriptions []*subscription
+	events        []Event
 }
 
 func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error) {
+	return s.RegisterAccountContext(context.Background(), phone)
+}
+
+func (s *Service) RegisterAccountContext(ctx context.Context, phone types.Phone) (*types.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	account, err := s.registerAccount(phone)
+	err = s.runHooks(ctx, OpRegisterAccount, err)
+	return account, err
+}
+
+func (s *Service) registerAccount(phone types.Phone) (*types.Account, error) {
 	for _, account := range s.accounts {
 		if account.Phone == phone {
 			return nil, ErrPhoneRegistered
@@ -34,17 +69,36 @@ func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error) {
 	}
 
 	s.nextAccountID++
+	now := s.now()
 	account := &types.Account{
 		ID:      s.nextAccountID,
 		Phone:   phone,
 		Balance: 0,
+		Updated: now,
+		Created: now,
 	}
 	s.accounts = append(s.accounts, account)
+	s.track("account", strconv.FormatInt(account.ID, 10), nil, *account)
+	s.emit(AccountRegistered{Account: *account})
 
 	return account, nil
 }
 
 func (s *Service) Deposit(accountID int64, amount types.Money) error {
+	return s.DepositContext(context.Background(), accountID, amount)
+}
+
+func (s *Service) DepositContext(ctx context.Context, accountID int64, amount types.Money) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := s.deposit(accountID, amount)
+	err = s.runHooks(ctx, OpDeposit, err)
+	return err
+}
+
+func (s *Service) deposit(accountID int64, amount types.Money) error {
 	if amount <= 0 {
 		return ErrAmountMustBePositive
 	}
@@ -62,11 +116,40 @@ func (s *Service) Deposit(accountID int64, amount types.Money) error {
 		return ErrAccountNotFound
 	}
 
+	now := s.now()
+	before := *account
 	account.Balance += amount
+	account.Updated = now
+	entry := &types.Entry{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Kind:      types.EntryDeposit,
+		Amount:    amount,
+		Created:   now,
+	}
+	s.entries = append(s.entries, entry)
+	s.track("account", strconv.FormatInt(account.ID, 10), before, *account)
+	s.track("entry", entry.ID, nil, *entry)
+	s.emit(Deposited{Account: *account, Amount: amount})
 	return nil
 }
 
 func (s *Service) Pay(accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	return s.PayContext(context.Background(), accountID, amount, category)
+}
+
+func (s *Service) PayContext(ctx context.Context, accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.pay(accountID, amount, category, "")
+	err = s.runHooks(ctx, OpPay, err)
+	return payment, err
+}
+
+//pay списывает платёж со счёта; favoriteID - избранное, из которого он создан, или пусто
+func (s *Service) pay(accountID int64, amount types.Money, category types.PaymentCategory, favoriteID string) (*types.Payment, error) {
 	if amount <= 0 {
 		return nil, ErrAmountMustBePositive
 	}
@@ -77,17 +160,43 @@ func (s *Service) Pay(accountID int64, amount types.Money, category types.Paymen
 		return nil, accountErr
 	}
 
-	account.Balance -= amount
+	now := s.now()
+	if err := s.checkLimits(account.ID, amount, category, now); err != nil {
+		return nil, err
+	}
+	review, err := s.screen(account, amount, category, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fee := s.fee(amount, category)
+	before := *account
+	account.Balance -= amount + fee
+	account.Updated = now
 	paymentID := uuid.New().String()
 	payment := &types.Payment{
-		ID:        paymentID,
-		AccountID: accountID,
-		Amount:    amount,
-		Category:  category,
-		Status:    types.PaymentStatusInProgress,
+		ID:         paymentID,
+		AccountID:  accountID,
+		Amount:     amount,
+		Category:   category,
+		Status:     types.PaymentStatusInProgress,
+		Updated:    now,
+		Created:    now,
+		FavoriteID: favoriteID,
 	}
 
 	s.payments = append(s.payments, payment)
+	if review != nil {
+		review.PaymentID = payment.ID
+		s.recordAttempt(*review)
+	}
+	s.track("account", strconv.FormatInt(account.ID, 10), before, *account)
+	s.track("payment", payment.ID, nil, *payment)
+	if fee > 0 {
+		s.chargeFee(payment, fee)
+	}
+	s.emit(PaymentCreated{Payment: *payment})
+	s.checkBudgets(payment)
 	return payment, nil
 }
 
@@ -108,6 +217,22 @@ func (s *Service) FindAccountByID(accountID int64) (*types.Account, error) {
 	return account, nil
 }
 
+func (s *Service) Accounts() []*types.Account {
+	return append([]*types.Account(nil), s.accounts...)
+}
+
+func (s *Service) Payments() []*types.Payment {
+	return append([]*types.Payment(nil), s.payments...)
+}
+
+func (s *Service) Favorites() []*types.Favorite {
+	return append([]*types.Favorite(nil), s.favorites...)
+}
+
+func (s *Service) Entries() []*types.Entry {
+	return append([]*types.Entry(nil), s.entries...)
+}
+
 func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
 	for _, payment := range s.payments {
 		if payment.ID == paymentID {
@@ -120,6 +245,20 @@ func (s *Service) FindPaymentByID(paymentID string) (*types.Payment, error) {
 }
 
 func (s *Service) Reject(paymentID string) error {
+	return s.RejectContext(context.Background(), paymentID)
+}
+
+func (s *Service) RejectContext(ctx context.Context, paymentID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := s.reject(paymentID)
+	err = s.runHooks(ctx, OpReject, err)
+	return err
+}
+
+func (s *Service) reject(paymentID string) error {
 
 	payment, err := s.FindPaymentByID(paymentID)
 
@@ -127,19 +266,81 @@ func (s *Service) Reject(paymentID string) error {
 		return err
 	}
 
+	//повторная отмена вернула бы сумму и комиссию ещё раз
+	if payment.Status == types.PaymentStatusFail {
+		return fmt.Errorf("%w: %s is %s", ErrPaymentNotInProgress, payment.ID, payment.Status)
+	}
+
 	account, err := s.FindAccountByID(payment.AccountID)
 
 	if err != nil {
 		return err
 	}
 
+	now := s.now()
+	accountBefore, paymentBefore := *account, *payment
 	account.Balance += payment.Amount
+	account.Updated = now
 	payment.Status = types.PaymentStatusFail
+	payment.Updated = now
+	s.track("account", strconv.FormatInt(account.ID, 10), accountBefore, *account)
+	s.track("payment", payment.ID, paymentBefore, *payment)
+	s.emit(PaymentRejected{Payment: *payment})
+	s.refundFee(account, payment)
+	s.clawbackRewards(payment)
+
+	return nil
+}
+
+//Confirm проводит платёж: переводит его из INPROGRESS в OK
+func (s *Service) Confirm(paymentID string) error {
+	return s.ConfirmContext(context.Background(), paymentID)
+}
+
+func (s *Service) ConfirmContext(ctx context.Context, paymentID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := s.confirm(paymentID)
+	err = s.runHooks(ctx, OpConfirm, err)
+	return err
+}
+
+func (s *Service) confirm(paymentID string) error {
+	payment, err := s.FindPaymentByID(paymentID)
+	if err != nil {
+		return err
+	}
+	if payment.Status != types.PaymentStatusInProgress {
+		return fmt.Errorf("%w: %s is %s", ErrPaymentNotInProgress, payment.ID, payment.Status)
+	}
+
+	paymentBefore := *payment
+	payment.Status = types.PaymentStatusOk
+	payment.Updated = s.now()
+	s.track("payment", payment.ID, paymentBefore, *payment)
+	s.emit(PaymentConfirmed{Payment: *payment})
+	s.creditRewards(payment)
 
 	return nil
 }
 
 func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
+	return s.RepeatContext(context.Background(), paymentID)
+}
+
+func (s *Service) RepeatContext(ctx context.Context, paymentID string) (*types.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.repeat(paymentID)
+	err = s.runHooks(ctx, OpRepeat, err)
+	return payment, err
+}
+
+func (s *Service) repeat(paymentID string) (*types.Payment, error) {
 	oldPayment, err := s.FindPaymentByID(paymentID)
 	if err != nil {
 		return nil, err
@@ -150,7 +351,7 @@ func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
 		return nil, err
 	}
 
-	newPayment, err := s.Pay(account.ID, oldPayment.Amount, oldPayment.Category)
+	newPayment, err := s.pay(account.ID, oldPayment.Amount, oldPayment.Category, "")
 	if err != nil {
 		return nil, err
 	}
@@ -159,6 +360,20 @@ func (s *Service) Repeat(paymentID string) (*types.Payment, error) {
 }
 
 func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorite, error) {
+	return s.FavoritePaymentContext(context.Background(), paymentID, name)
+}
+
+func (s *Service) FavoritePaymentContext(ctx context.Context, paymentID string, name string) (*types.Favorite, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	favorite, err := s.favoritePayment(paymentID, name)
+	err = s.runHooks(ctx, OpFavoritePayment, err)
+	return favorite, err
+}
+
+func (s *Service) favoritePayment(paymentID string, name string) (*types.Favorite, error) {
 	payment, err := s.FindPaymentByID(paymentID)
 	if err != nil {
 		return nil, err
@@ -176,9 +391,12 @@ func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorit
 		Name:      name,
 		Amount:    payment.Amount,
 		Category:  payment.Category,
+		Updated:   s.now(),
 	}
 
 	s.favorites = append(s.favorites, favorite)
+	s.track("favorite", favorite.ID, nil, *favorite)
+	s.emit(FavoriteCreated{Favorite: *favorite})
 	return favorite, nil
 }
 
@@ -194,6 +412,20 @@ func (s *Service) FindFavoritePaymentByID(favorityID string) (*types.Favorite, e
 }
 
 func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
+	return s.PayFromFavoriteContext(context.Background(), favoriteID)
+}
+
+func (s *Service) PayFromFavoriteContext(ctx context.Context, favoriteID string) (*types.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.payFromFavorite(favoriteID)
+	err = s.runHooks(ctx, OpPayFromFavorite, err)
+	return payment, err
+}
+
+func (s *Service) payFromFavorite(favoriteID string) (*types.Payment, error) {
 	favorite, err := s.FindFavoritePaymentByID(favoriteID)
 	if err != nil {
 		return nil, err
@@ -204,7 +436,7 @@ func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
 		return nil, err
 	}
 
-	payment, err := s.Pay(account.ID, favorite.Amount, favorite.Category)
+	payment, err := s.pay(account.ID, favorite.Amount, favorite.Category, favorite.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -212,385 +444,177 @@ func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
 	return payment, nil
 }
 
-///////////////////////////////////////////////////////////
-func (s *Service) ExportToFile(path string) error {
-
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
+////////////////
+func (s *Service) Export(dir string, opts ...Option) error {
+	return s.ExportContext(context.Background(), dir, opts...)
+}
 
-	content := ""
+func (s *Service) ExportContext(ctx context.Context, dir string, opts ...Option) error {
+	err := s.export(ctx, dir, newOptions(opts))
+	err = s.runHooks(ctx, OpExport, err)
+	return err
+}
 
-	for index, account := range s.accounts {
-		content += strconv.FormatInt(int64(account.ID), 10) + ";" + string(account.Phone) + ";" + strconv.FormatInt(int64(account.Balance), 10)
-		if index != len(s.accounts)-1 {
-			content += "|"
-		}
+func (s *Service) export(ctx context.Context, dir string, o options) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	_, err = file.Write([]byte(content))
+	snap := s.snapshot()
+	manifest, err := exportSections(ctx, snap, o, func(name string, write func(w io.Writer) error) (string, error) {
+		return writeFile(filepath.Join(dir, name), write)
+	})
 	if err != nil {
 		return err
 	}
 
-	//defer func(){
-	err = file.Close()
-	if err != nil {
-		return err
+	//пустые секции не выгружаются, а файл прошлой выгрузки удаляется
+	for _, sec := range sections {
+		if sec.count(snap) != 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, sec.name+o.format.ext())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
-	//}()
 
-	return nil
+	return writeManifest(dir, o.format, manifest)
 }
 
-//////////////////////////////////////////////
-func (s *Service) ImportFromFile(path string) error {
-	file, err := os.Open(path)
-	if err != nil {
+func (s *Service) Import(dir string, opts ...Option) error {
+	return s.ImportContext(context.Background(), dir, opts...)
+}
+
+//ImportContext сначала читает все файлы выгрузки и только потом меняет сервис,
+//поэтому ошибка в любом файле оставляет сервис без изменений. Записи с уже
+//существующими ID сливаются по стратегии WithMergeStrategy
+func (s *Service) ImportContext(ctx context.Context, dir string, opts ...Option) error {
+	err := s.importDir(ctx, dir, newOptions(opts))
+	err = s.runHooks(ctx, OpImport, err)
+	return err
+}
+
+func (s *Service) importDir(ctx context.Context, dir string, o options) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	buf := make([]byte, 4096)
-	read, err := file.Read(buf)
+	snap, err := readDir(ctx, dir, o)
 	if err != nil {
+		log.Print(err)
 		return err
 	}
 
-	content := string(buf[:read])
-
-	accounts := strings.Split(content, "|")
-
-	for _, account := range accounts {
-		accountConvArr := strings.Split(account, ";")
-
-		importedAccount, err := s.RegisterAccount(types.Phone(accountConvArr[1])) //account phone
-		if err != nil {
-			return err
-		}
-
-		balance, err := strconv.ParseInt(accountConvArr[2], 10, 64) //account balance
-		if err != nil {
-			return err
-		}
-
-		if balance > 0 {
-			err = s.Deposit(importedAccount.ID, types.Money(balance))
-			if err != nil {
-				return err
-			}
-		}
-	}
+	return s.mergeImported(snap, o)
+}
 
-	err = file.Close()
+//mergeImported сливает прочитанный снапшот с сервисом и сообщает итоги
+func (s *Service) mergeImported(snap *snapshot, o options) error {
+	summary, err := s.merge(snap, o.merge)
 	if err != nil {
+		log.Print(err)
 		return err
 	}
-
+	if o.summary != nil {
+		*o.summary = summary
+	}
+	s.track("import", "", nil, summary)
+	log.Printf("Imported: %v", summary)
 	return nil
 }
 
-////////////////
-func (s *Service) Export(dir string) error {
-	FavLen := len(s.favorites)
-	PayLen := len(s.payments)
-	AccLen := len(s.accounts)
-
-	if AccLen > 0 {
-
-		DumpDir := dir + "/accounts.dump"
-		
-		file, err := os.Create(DumpDir)
-    if err != nil {
-        return err
-    }
-    defer func() {
-	  if cerr:=	file.Close(); cerr != nil {
-     log.Print(cerr)
-	  }
-	}()
-
-	for _, account := range s.accounts {
-		txtitemue := []byte(strconv.FormatInt(int64(account.ID), 10) + string(";") + string(account.Phone) + string(";") + strconv.FormatInt(int64(account.Balance), 10) + string(";") + string('\n'))
-		_, err = file.Write(txtitemue)
-		if err != nil {
-			return err
-		}
+//snapshot возвращает текущие записи сервиса
+func (s *Service) snapshot() *snapshot {
+	return &snapshot{
+		accounts:  s.accounts,
+		payments:  s.payments,
+		favorites: s.favorites,
+		entries:   s.entries,
+		attempts:  s.fraudAttempts,
+		accruals:  s.accrualList(),
+		limits:    s.limits,
+		budgets:   s.budgets,
 	}
 }
 
-	if FavLen > 0 { //// Данные есть
-
-		DumpDir := dir + "/favorites.dump"
-
-			file, err := os.Create(DumpDir)
-			if err != nil {
-				return err
-			}
-			defer func() {
-			  if cerr:=	file.Close(); cerr != nil {
-			 log.Print(cerr)
-			  }
-			}()
-
-			for _, fav := range s.favorites {
-				text := []byte(fav.ID + ";" + strconv.FormatInt(int64(fav.AccountID), 10) + ";" + fav.Name + ";" + strconv.FormatInt(int64(fav.Amount), 10) + ";" + string(fav.Category) + string('\n'))
-				_, err := file.Write(text)
-				if err != nil {
-					log.Print(err)
-					return err
-				}
-			}
+//writeFile создаёт файл path, пишет в него через буфер с помощью write и
+//возвращает SHA-256 записанного содержимого
+func writeFile(path string, write func(w io.Writer) error) (checksum string, err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil && err == nil {
+			err = cerr
 		}
+	}()
 
-    if PayLen > 0 {
-
-		DumpDir := dir + "/payments.dump"
-	   
-			file, err := os.Create(DumpDir)
-			if err != nil {
-				return err
-			}
-			defer func() {
-			  if cerr:=	file.Close(); cerr != nil {
-			 log.Print(cerr)
-			  }
-			}()
-		
-			for _, payment := range s.payments {
-				txtitemue := []byte(string(payment.ID) + string(";") + strconv.FormatInt(int64(payment.AccountID), 10) + string(";") + strconv.FormatInt(int64(payment.Amount), 10) + string(";") + string(payment.Category) + string(";") + string(payment.Status) + string(";") + string('\n'))
-				_, err = file.Write(txtitemue)
-				if err != nil {
-					return err
-				}
-			}
+	hasher := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(file, hasher))
+	if err := write(buffered); err != nil {
+		return "", err
 	}
-
-   return nil
+	if err := buffered.Flush(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-func (s *Service) Import(dir string) error {
-	//For accounts
-	accountFile := "/accounts.dump"
-	src, err := os.Open(dir + accountFile)
-	if err != nil {
-		log.Print("There is no %w file", accountFile)
-	} else {
-		defer func() {
-			if cerr := src.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		reader := bufio.NewReader(src)
-		for {
-			line, err := reader.ReadString('\n')
-			if err == io.EOF {
-				log.Print(line)
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-
-			item := strings.Split(line, ";")
-
-			id, err := strconv.ParseInt(item[0], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-
-			phone := item[1]
-
-			balance, err := strconv.ParseInt(item[2], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-
-			findAccount, _ := s.FindAccountByID(id)
-			if findAccount != nil {
-				findAccount.Phone = types.Phone(phone)
-				findAccount.Balance = types.Money(balance)
-			} else {
-				s.nextAccountID = id
-				newAcc := &types.Account{
-					ID:      s.nextAccountID,
-					Phone:   types.Phone(phone),
-					Balance: types.Money(balance),
-				}
-
-				s.accounts = append(s.accounts, newAcc)
-			}
-		}
-		log.Print("Imported")
+/////////////////////////
+func (s *Service) SumPayments(goroutines int) types.Money {
+	sum, _ := s.SumPaymentsContext(context.Background(), goroutines)
+	return sum
+}
 
+func (s *Service) SumPaymentsContext(ctx context.Context, goroutines int) (types.Money, error) {
+	if goroutines < 1 {
+		goroutines = 1
 	}
 
-	// For Payments
-	paymentsFile := "/payments.dump"
-	paySrc, err := os.Open(dir + paymentsFile)
-	if err != nil {
-		log.Print("There is no %w file", paymentsFile)
-	} else {
-		defer func() {
-			if cerr := paySrc.Close(); cerr != nil {
-				log.Print(cerr)
-			}
-		}()
-
-		payReader := bufio.NewReader(paySrc)
-		for {
-			payLine, err := payReader.ReadString('\n')
-			if err == io.EOF {
-				log.Print(payLine)
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-
-			item := strings.Split(payLine, ";")
+	sum := types.Money(0)
+	slices := (len(s.payments) / goroutines) + 1
+	mutx := sync.Mutex{}
+	wg := sync.WaitGroup{}
 
-			id := string(item[0])
-			accID, err := strconv.ParseInt(item[1], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
-			}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
 
-			amount, err := strconv.ParseInt(item[2], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
+		go func(val int) {
+			defer wg.Done()
+			money := types.Money(0)
+			begin := val * slices
+			end := begin + slices
+			if end > len(s.payments) {
+				end = len(s.payments)
 			}
-
-			category := item[3]
-
-			status := item[4]
-
-			findPay, _ := s.FindPaymentByID(id)
-			if findPay != nil {
-				findPay.AccountID = accID
-				findPay.Amount = types.Money(amount)
-				findPay.Category = types.PaymentCategory(category)
-				findPay.Status = types.PaymentStatus(status)
-			} else {
-				newPay := &types.Payment{
-					ID:        id,
-					AccountID: accID,
-					Amount:    types.Money(amount),
-					Category:  types.PaymentCategory(category),
-					Status:    types.PaymentStatus(status),
+			for j := begin; j < end; j++ {
+				if err := checkContext(ctx, j-begin); err != nil {
+					return
 				}
-
-				s.payments = append(s.payments, newPay)
+				money += s.payments[j].Amount
 			}
-		}
-		log.Print("Imported")
+			mutx.Lock()
+			defer mutx.Unlock()
+			sum += money
+		}(i)
 	}
+	wg.Wait()
 
-	//For favorites
-	favoritesFile := "/favorites.dump"
-	favFile, err := os.Open(dir + favoritesFile)
-	if err != nil {
-		log.Print("There is no such %w a file", favoritesFile)
-	} else {
-		reader := bufio.NewReader(favFile)
-		for {
-			favLine, err := reader.ReadString('\n')
-			if err == io.EOF {
-				log.Print(favLine)
-				break
-			}
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-
-			item := strings.Split(favLine, ";")
-
-			id := item[0]
-			accID, err := strconv.ParseInt(item[1], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-			name := item[2]
-			amount, err := strconv.ParseInt(item[3], 10, 64)
-			if err != nil {
-				log.Print(err)
-				return err
-			}
-			category := item[4]
-
-			findFav, _ := s.FindFavoritePaymentByID(id)
-			if findFav != nil {
-				findFav.AccountID = accID
-				findFav.Amount = types.Money(amount)
-				findFav.Name = name
-				findFav.Category = types.PaymentCategory(category)
-			} else {
-				newFav := &types.Favorite{
-					ID:        id,
-					AccountID: accID,
-					Name:      name,
-					Amount:    types.Money(amount),
-					Category:  types.PaymentCategory(category),
-				}
-				s.favorites = append(s.favorites, newFav)
-			}
-		}
-		log.Print("Imported")
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
-
-	return nil
+	return sum, nil
 }
 
-/////////////////////////
-func (s *Service) SumPayments(goroutines int) types.Money{
-
-	sum := types.Money(0)
-	slices := (len(s.payments)/goroutines) + 1
-	mutx := sync.Mutex{}
-	wg := sync.WaitGroup{}
-
-	if slices == 0 {
-		return 0
-	}
-
-	if slices == 1 {
-		return s.payments[0].Amount
-	}	
-		
-		for i := 0; i < goroutines; i++ {
-			wg.Add(1)
-			money := types.Money(0)
-		
-			go func(val int) {
-				defer wg.Done()
-				begin := val * slices
-				end := (val * slices) + slices
-				for j := begin; j < end; j++ {
-					if j > len(s.payments)-1 {
-						break
-					} 
-					money += s.payments[j].Amount
-				}
-				mutx.Lock()
-				defer mutx.Unlock()
-				sum += money
-			}(i)
-		}
-		wg.Wait()
-		return sum
-}
 ////////////////////////////////////
 
 func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
+	return s.SumPaymentsWithProgressContext(context.Background())
+}
+
+//SumPaymentsWithProgressContext прекращает подсчёт и закрывает канал при отмене ctx
+func (s *Service) SumPaymentsWithProgressContext(ctx context.Context) <-chan types.Progress {
 	pice := 100_0000
 
 	Money := make([]types.Money, 0)
@@ -599,7 +623,7 @@ func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
 	}
 
 	wg := sync.WaitGroup{}
-	goroutines := (len(Money) + 1) / pice
+	goroutines := (len(Money) + pice - 1) / pice
 	chnl := make(chan types.Progress)
 
 	if goroutines <= 0 {
@@ -608,19 +632,29 @@ func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
 
 	for i := 0; i < goroutines; i++ {
 		wg.Add(1)
-		
+
+		begin := i * pice
+		end := begin + pice
+		if end > len(Money) {
+			end = len(Money)
+		}
+
 		go func(chnl chan<- types.Progress, Money []types.Money, part int) {
 			sum := 0
 			defer wg.Done()
-	
-	for _, val := range Money {
+
+			for index, val := range Money {
+				if err := checkContext(ctx, index); err != nil {
+					return
+				}
 				sum += int(val)
-	}
-			chnl <- types.Progress{
-				Result: types.Money(sum),
 			}
-			
-		}(chnl, Money, i)
+
+			select {
+			case chnl <- types.Progress{Part: part, Result: types.Money(sum)}:
+			case <-ctx.Done():
+			}
+		}(chnl, Money[begin:end], i)
 	}
 
 	go func() {
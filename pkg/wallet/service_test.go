@@ -1,6 +1,8 @@
 package wallet
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
@@ -272,6 +274,46 @@ func TestService_Reject_success(t *testing.T) {
 	}
 }
 
+func TestService_Reject_twice(t *testing.T) {
+	s := newTestService()
+	_, payments, _, err := s.addAccount(defaultTestAccount)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment := payments[0]
+	if err := s.Reject(payment.ID); err != nil {
+		t.Errorf("Reject(): error=%v", err)
+		return
+	}
+
+	//повторная отмена не должна вернуть сумму ещё раз
+	var rejected int
+	s.Subscribe(func(ctx context.Context, event Event) {
+		if _, ok := event.(PaymentRejected); ok {
+			rejected++
+		}
+	})
+	err = s.Reject(payment.ID)
+	if !errors.Is(err, ErrPaymentNotInProgress) {
+		t.Errorf("Reject() twice: want %v, got %v", ErrPaymentNotInProgress, err)
+		return
+	}
+
+	account, err := s.FindAccountByID(payment.AccountID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if account.Balance != defaultTestAccount.balance {
+		t.Errorf("Reject() twice: balance changed, account=%v", account)
+	}
+	if rejected != 0 {
+		t.Errorf("Reject() twice: want no PaymentRejected events, got %d", rejected)
+	}
+}
+
 func TestService_Repeat_success(t *testing.T) {
 	//создаём сервис
 	s := newTestService()
@@ -0,0 +1,269 @@
+package wallet
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+//Виды строк выписки помимо видов проводок types.EntryKind
+const (
+	StatementPayment = "payment" // списание платежа
+	StatementRefund  = "refund"  // возврат отменённого платежа
+)
+
+//StatementLine - изменение баланса счёта в выписке
+type StatementLine struct {
+	Time      time.Time             `json:"time"`
+	Kind      string                `json:"kind"` // StatementPayment, StatementRefund или вид проводки
+	PaymentID string                `json:"paymentId,omitempty"`
+	Category  types.PaymentCategory `json:"category,omitempty"`
+	Amount    types.Money           `json:"amount"`  // со знаком: списание отрицательно
+	Balance   types.Money           `json:"balance"` // после изменения
+}
+
+//FavoriteUsage - платежи из избранного за период выписки
+type FavoriteUsage struct {
+	Favorite types.Favorite `json:"favorite"`
+	Count    int            `json:"count"`
+	Total    types.Money    `json:"total"`
+}
+
+//Statement - выписка по счёту за период [From, To)
+type Statement struct {
+	Account   types.Account   `json:"account"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Opening   types.Money     `json:"opening"`
+	Closing   types.Money     `json:"closing"`
+	Deposited types.Money     `json:"deposited"` // пополнения и проценты
+	Paid      types.Money     `json:"paid"`      // платежи и комиссии за вычетом возвратов
+	Lines     []StatementLine `json:"lines"`
+	Favorites []FavoriteUsage `json:"favorites"`
+}
+
+//Statement составляет выписку по счёту за период [from, to). Остатки
+//восстанавливаются от текущего баланса вычитанием всех последующих изменений,
+//поэтому выписка за прошедший период не меняется от новых операций. Платежи с
+//неизвестным временем создания и пополнения из выгрузок до v6 в строки не
+//попадают и учтены во входящем остатке
+func (s *Service) Statement(accountID int64, from time.Time, to time.Time) (*Statement, error) {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	from, to = from.UTC(), to.UTC()
+
+	statement := &Statement{Account: *account, From: from, To: to, Closing: account.Balance}
+	history := s.balanceHistory(accountID)
+	for _, line := range history {
+		if !line.Time.Before(to) {
+			statement.Closing -= line.Amount
+		}
+	}
+
+	statement.Opening = statement.Closing
+	for _, line := range history {
+		if !line.Time.Before(from) && line.Time.Before(to) {
+			statement.Opening -= line.Amount
+		}
+	}
+	balance := statement.Opening
+
+	favorites := make(map[string]int)
+	for _, line := range history {
+		if line.Time.Before(from) || !line.Time.Before(to) {
+			continue
+		}
+		balance += line.Amount
+		line.Balance = balance
+		statement.Lines = append(statement.Lines, line)
+
+		switch types.EntryKind(line.Kind) {
+		case types.EntryDeposit, types.EntryInterest:
+			statement.Deposited += line.Amount
+		default:
+			statement.Paid -= line.Amount
+		}
+		if line.Kind == StatementPayment {
+			s.countFavorite(statement, favorites, line.PaymentID)
+		}
+	}
+	return statement, nil
+}
+
+//MonthStatement составляет выписку по счёту за календарный месяц (UTC), в который попадает month
+func (s *Service) MonthStatement(accountID int64, month time.Time) (*Statement, error) {
+	month = month.UTC()
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return s.Statement(accountID, from, from.AddDate(0, 1, 0))
+}
+
+//balanceHistory возвращает все известные изменения баланса счёта по времени
+func (s *Service) balanceHistory(accountID int64) []StatementLine {
+	var history []StatementLine
+	linked := make(map[string][]StatementLine)
+	for _, entry := range s.entries {
+		if entry.AccountID != accountID {
+			continue
+		}
+		line := StatementLine{Time: entry.Created, Kind: string(entry.Kind), PaymentID: entry.PaymentID}
+		switch entry.Kind {
+		case types.EntryDeposit, types.EntryInterest, types.EntryFeeRefund:
+			line.Amount = entry.Amount
+		case types.EntryFee:
+			line.Amount = -entry.Amount
+		default:
+			//кэшбэк меняет бонусный, а не основной баланс
+			continue
+		}
+		if entry.PaymentID == "" {
+			history = append(history, line)
+			continue
+		}
+		linked[entry.PaymentID] = append(linked[entry.PaymentID], line)
+	}
+
+	for _, payment := range s.payments {
+		if payment.AccountID != accountID || payment.Created.IsZero() {
+			continue
+		}
+		line := StatementLine{
+			Time:      payment.Created,
+			Kind:      StatementPayment,
+			PaymentID: payment.ID,
+			Category:  payment.Category,
+			Amount:    -payment.Amount,
+		}
+		history = append(history, line)
+		if payment.Status == types.PaymentStatusFail {
+			line.Time = payment.Updated
+			line.Kind = StatementRefund
+			line.Amount = payment.Amount
+			history = append(history, line)
+		}
+		for _, entry := range linked[payment.ID] {
+			entry.Category = payment.Category
+			history = append(history, entry)
+		}
+	}
+
+	//при равном времени платёж остаётся перед своей комиссией
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history
+}
+
+//countFavorite учитывает платёж paymentID, если он создан из избранного
+func (s *Service) countFavorite(statement *Statement, favorites map[string]int, paymentID string) {
+	payment, err := s.FindPaymentByID(paymentID)
+	if err != nil || payment.FavoriteID == "" {
+		return
+	}
+
+	i, found := favorites[payment.FavoriteID]
+	if !found {
+		usage := FavoriteUsage{Favorite: types.Favorite{ID: payment.FavoriteID}}
+		if favorite, err := s.FindFavoritePaymentByID(payment.FavoriteID); err == nil {
+			usage.Favorite = *favorite
+		}
+		i = len(statement.Favorites)
+		favorites[payment.FavoriteID] = i
+		statement.Favorites = append(statement.Favorites, usage)
+	}
+	statement.Favorites[i].Count++
+	statement.Favorites[i].Total += payment.Amount
+}
+
+//statementFuncs - функции шаблонов выписки
+func statementFuncs(locale Locale) map[string]interface{} {
+	return map[string]interface{}{
+		"money": locale.FormatMoney,
+		"date": func(t time.Time) string {
+			return t.Format("2006-01-02")
+		},
+		"time": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04")
+		},
+		//последний день периода: To не входит в выписку
+		"until": func(t time.Time) string {
+			return t.Add(-time.Nanosecond).Format("2006-01-02")
+		},
+	}
+}
+
+const statementText = `Statement for account {{.Account.ID}} ({{.Account.Phone}})
+Period: {{date .From}} - {{until .To}}
+
+Opening balance: {{money .Opening}}
+{{range .Lines}}
+{{time .Time}}  {{printf "%-10s" .Kind}}  {{printf "%12s" (money .Amount)}}  {{printf "%12s" (money .Balance)}}{{if .Category}}  {{.Category}}{{end}}{{if .PaymentID}}  {{.PaymentID}}{{end}}
+{{- else}}
+No operations
+{{- end}}
+
+Deposited: {{money .Deposited}}
+Paid: {{money .Paid}}
+Closing balance: {{money .Closing}}
+{{- if .Favorites}}
+
+Favorites used:
+{{- range .Favorites}}
+  {{.Favorite.Name}}: {{.Count}} payments, {{money .Total}}
+{{- end}}
+{{- end}}
+`
+
+const statementHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Statement for account {{.Account.ID}}, {{date .From}} - {{until .To}}</title>
+</head>
+<body>
+<h1>Statement for account {{.Account.ID}} ({{.Account.Phone}})</h1>
+<p>Period: {{date .From}} - {{until .To}}</p>
+<p>Opening balance: {{money .Opening}}</p>
+<table>
+<tr><th>Time</th><th>Operation</th><th>Category</th><th>Payment</th><th>Amount</th><th>Balance</th></tr>
+{{- range .Lines}}
+<tr><td>{{time .Time}}</td><td>{{.Kind}}</td><td>{{.Category}}</td><td>{{.PaymentID}}</td><td>{{money .Amount}}</td><td>{{money .Balance}}</td></tr>
+{{- end}}
+</table>
+<p>Deposited: {{money .Deposited}}</p>
+<p>Paid: {{money .Paid}}</p>
+<p>Closing balance: {{money .Closing}}</p>
+{{- if .Favorites}}
+<h2>Favorites used</h2>
+<ul>
+{{- range .Favorites}}
+<li>{{.Favorite.Name}}: {{.Count}} payments, {{money .Total}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`
+
+//WriteText пишет выписку в w простым текстом с суммами по правилам locale
+func (st *Statement) WriteText(w io.Writer, locale Locale) error {
+	tmpl, err := template.New("statement").Funcs(statementFuncs(locale)).Parse(statementText)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, st)
+}
+
+//WriteHTML пишет выписку в w HTML-страницей с суммами по правилам locale
+func (st *Statement) WriteHTML(w io.Writer, locale Locale) error {
+	tmpl, err := htmltemplate.New("statement").Funcs(statementFuncs(locale)).Parse(statementHTML)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, st)
+}
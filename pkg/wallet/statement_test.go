@@ -0,0 +1,130 @@
+package wallet
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+func TestService_MonthStatement(t *testing.T) {
+	now := time.Date(2020, 11, 1, 10, 0, 0, 0, time.UTC)
+	s := newTestService()
+	s.SetClock(func() time.Time { return now })
+	at := func(day int) {
+		now = time.Date(2020, 11, day, 10, 0, 0, 0, time.UTC)
+	}
+	if err := s.SetFeeSchedule(Fee{Category: "auto", Fixed: 1_00}); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := s.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at(2)
+	if err := s.Deposit(account.ID, 1_000_00); err != nil {
+		t.Fatal(err)
+	}
+	at(3)
+	payment, err := s.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorite, err := s.FavoritePayment(payment.ID, "<b>Car</b>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at(5)
+	if _, err := s.PayFromFavorite(favorite.ID); err != nil {
+		t.Fatal(err)
+	}
+	food, err := s.Pay(account.ID, 50_00, "food")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at(6)
+	if err := s.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	november := time.Date(2020, 11, 15, 0, 0, 0, 0, time.UTC)
+	statement, err := s.MonthStatement(account.ID, november)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind    string
+		amount  types.Money
+		balance types.Money
+	}{
+		{string(types.EntryDeposit), 1_000_00, 1_000_00},
+		{StatementPayment, -100_00, 900_00},
+		{string(types.EntryFee), -1_00, 899_00},
+		{StatementPayment, -100_00, 799_00},
+		{string(types.EntryFee), -1_00, 798_00},
+		{StatementPayment, -50_00, 748_00},
+		{StatementRefund, 100_00, 848_00},
+		{string(types.EntryFeeRefund), 1_00, 849_00},
+	}
+	if len(statement.Lines) != len(want) {
+		t.Fatalf("MonthStatement(): want %d lines, got %+v", len(want), statement.Lines)
+	}
+	for i, line := range statement.Lines {
+		if line.Kind != want[i].kind || line.Amount != want[i].amount || line.Balance != want[i].balance {
+			t.Errorf("line %d: want %s %d -> %d, got %+v", i, want[i].kind, want[i].amount, want[i].balance, line)
+		}
+	}
+	if statement.Opening != 0 || statement.Closing != 849_00 || statement.Deposited != 1_000_00 || statement.Paid != 151_00 {
+		t.Errorf("MonthStatement(): want 0 -> 84900, deposited 100000, paid 15100, got %+v", statement)
+	}
+	if len(statement.Favorites) != 1 || statement.Favorites[0].Favorite.ID != favorite.ID || statement.Favorites[0].Count != 1 || statement.Favorites[0].Total != 100_00 {
+		t.Errorf("MonthStatement(): want favorite used once, got %+v", statement.Favorites)
+	}
+
+	//операции следующего месяца не меняют выписку за прошедший
+	now = time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.Deposit(account.ID, 500_00); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject(food.ID); err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.MonthStatement(account.ID, november)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Opening != statement.Opening || again.Closing != statement.Closing || !reflect.DeepEqual(again.Lines, statement.Lines) {
+		t.Errorf("MonthStatement() after December: want same statement, got %+v", again)
+	}
+	december, err := s.MonthStatement(account.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if december.Opening != 849_00 || december.Closing != account.Balance || len(december.Lines) != 2 {
+		t.Errorf("MonthStatement(December): want 84900 -> %d in 2 lines, got %+v", account.Balance, december)
+	}
+
+	var text bytes.Buffer
+	if err := statement.WriteText(&text, LocaleEN); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"Period: 2020-11-01 - 2020-11-30", "Opening balance: 0.00", "Closing balance: 849.00", "<b>Car</b>: 1 payments, 100.00"} {
+		if !strings.Contains(text.String(), part) {
+			t.Errorf("WriteText(): want %q in\n%s", part, text.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := statement.WriteHTML(&html, LocaleRU); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"Closing balance: 849,00", "&lt;b&gt;Car&lt;/b&gt;", "<td>1 000,00</td>"} {
+		if !strings.Contains(html.String(), part) {
+			t.Errorf("WriteHTML(): want %q in\n%s", part, html.String())
+		}
+	}
+}
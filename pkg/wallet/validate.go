@@ -0,0 +1,288 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+)
+
+var ErrUnknownStatus = errors.New("unknown payment status")
+var ErrDuplicateID = errors.New("duplicate id")
+var ErrUnknownAccount = errors.New("referenced account does not exist")
+var ErrUnknownEntryKind = errors.New("unknown entry kind")
+
+//ImportProblem - ошибка в записи выгрузки или расхождение файла с манифестом
+type ImportProblem struct {
+	File   string
+	Line   int // 0 для JSON-массивов и проблем всего файла
+	Record int // 0 для заголовка и проблем всего файла
+	Text   string
+	Err    error
+}
+
+func (p ImportProblem) Error() string {
+	return (&ParseError{File: p.File, Line: p.Line, Record: p.Record, Text: p.Text, Err: p.Err}).Error()
+}
+
+//ImportReport - результат ValidateImport: число разобранных записей и все найденные проблемы
+type ImportReport struct {
+	Dir       string
+	Accounts  int
+	Payments  int
+	Favorites int
+	Entries   int
+	Attempts  int
+	Accruals  int
+	Limits    int
+	Budgets   int
+	Problems  []ImportProblem
+}
+
+//OK сообщает, что в выгрузке не найдено проблем
+func (r *ImportReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ImportReport) String() string {
+	lines := []string{fmt.Sprintf("%s: %d accounts, %d payments, %d favorites, %d entries, %d fraud attempts, %d accruals, %d limits, %d budgets, %d problems",
+		r.Dir, r.Accounts, r.Payments, r.Favorites, r.Entries, r.Attempts, r.Accruals, r.Limits, r.Budgets, len(r.Problems))}
+	for _, problem := range r.Problems {
+		lines = append(lines, problem.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//ValidateImport - пробный Import: читает все файлы выгрузки из dir, проверяет
+//каждую запись (числа, статусы платежей, существование счетов, на которые
+//ссылаются платежи и избранное) и возвращает отчёт со всеми проблемами.
+//Сервис не меняется. Ошибка возвращается, только если выгрузку не прочитать
+func (s *Service) ValidateImport(dir string, opts ...Option) (*ImportReport, error) {
+	return s.ValidateImportContext(context.Background(), dir, opts...)
+}
+
+func (s *Service) ValidateImportContext(ctx context.Context, dir string, opts ...Option) (*ImportReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Dir: dir}
+	//позиции разобранных записей по секциям, в порядке записей снапшота
+	positions := make(map[string][]ParseError)
+	o := newOptions(opts)
+	snap, mismatches, err := scanDir(ctx, dir, o, func(sec section, record *ParseError) error {
+		if record.Err != nil {
+			report.add(*record)
+			return nil
+		}
+		positions[sec.name] = append(positions[sec.name], *record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mismatch := range mismatches {
+		report.Problems = append(report.Problems, ImportProblem{
+			File: filepath.Join(dir, mismatch.File),
+			Err:  fmt.Errorf("%w: %s", ErrManifestMismatch, mismatch.Problem),
+		})
+	}
+
+	report.Accounts = len(snap.accounts)
+	report.Payments = len(snap.payments)
+	report.Favorites = len(snap.favorites)
+	report.Entries = len(snap.entries)
+	report.Attempts = len(snap.attempts)
+	report.Accruals = len(snap.accruals)
+	report.Limits = len(snap.limits)
+	report.Budgets = len(snap.budgets)
+	s.validateSnapshot(snap, positions, report)
+
+	//проблемы упорядочены по файлам в порядке Import и по записям внутри файла
+	order := make(map[string]int, len(sections))
+	for i, sec := range sections {
+		order[filepath.Join(dir, sec.name+o.format.ext())] = i
+	}
+	sort.SliceStable(report.Problems, func(i, j int) bool {
+		a, b := report.Problems[i], report.Problems[j]
+		if order[a.File] != order[b.File] {
+			return order[a.File] < order[b.File]
+		}
+		return a.Record < b.Record
+	})
+	return report, nil
+}
+
+func (r *ImportReport) add(record ParseError) {
+	r.Problems = append(r.Problems, ImportProblem{
+		File:   record.File,
+		Line:   record.Line,
+		Record: record.Record,
+		Text:   record.Text,
+		Err:    record.Err,
+	})
+}
+
+//validateSnapshot проверяет разобранные записи и добавляет проблемы в report.
+//Счета снапшота дополняют счета сервиса так же, как при Import
+func (s *Service) validateSnapshot(snap *snapshot, positions map[string][]ParseError, report *ImportReport) {
+	problem := func(section string, i int, err error) {
+		record := positions[section][i]
+		record.Err = err
+		report.add(record)
+	}
+
+	phones := make(map[types.Phone]int64, len(s.accounts))
+	accounts := make(map[int64]bool, len(s.accounts))
+	for _, account := range s.accounts {
+		phones[account.Phone] = account.ID
+		accounts[account.ID] = true
+	}
+
+	imported := make(map[int64]bool, len(snap.accounts))
+	for i, account := range snap.accounts {
+		switch {
+		case account.ID <= 0:
+			problem("accounts", i, fmt.Errorf("invalid id %d", account.ID))
+		case imported[account.ID]:
+			problem("accounts", i, fmt.Errorf("%w %d", ErrDuplicateID, account.ID))
+		case account.Phone == "":
+			problem("accounts", i, errors.New("empty phone"))
+		case phones[account.Phone] != 0 && phones[account.Phone] != account.ID:
+			problem("accounts", i, fmt.Errorf("%w: %s", ErrPhoneRegistered, account.Phone))
+		}
+		imported[account.ID] = true
+		accounts[account.ID] = true
+		phones[account.Phone] = account.ID
+	}
+
+	payments := make(map[string]bool, len(snap.payments))
+	for i, payment := range snap.payments {
+		switch {
+		case payment.ID == "":
+			problem("payments", i, errors.New("empty id"))
+		case payments[payment.ID]:
+			problem("payments", i, fmt.Errorf("%w %s", ErrDuplicateID, payment.ID))
+		case !accounts[payment.AccountID]:
+			problem("payments", i, fmt.Errorf("%w: %d", ErrUnknownAccount, payment.AccountID))
+		case payment.Amount <= 0:
+			problem("payments", i, ErrAmountMustBePositive)
+		case !knownStatus(payment.Status):
+			problem("payments", i, fmt.Errorf("%w %q", ErrUnknownStatus, payment.Status))
+		}
+		payments[payment.ID] = true
+	}
+
+	favorites := make(map[string]bool, len(snap.favorites))
+	for i, favorite := range snap.favorites {
+		switch {
+		case favorite.ID == "":
+			problem("favorites", i, errors.New("empty id"))
+		case favorites[favorite.ID]:
+			problem("favorites", i, fmt.Errorf("%w %s", ErrDuplicateID, favorite.ID))
+		case !accounts[favorite.AccountID]:
+			problem("favorites", i, fmt.Errorf("%w: %d", ErrUnknownAccount, favorite.AccountID))
+		case favorite.Amount <= 0:
+			problem("favorites", i, ErrAmountMustBePositive)
+		}
+		favorites[favorite.ID] = true
+	}
+
+	entries := make(map[string]bool, len(snap.entries))
+	for i, entry := range snap.entries {
+		switch {
+		case entry.ID == "":
+			problem("entries", i, errors.New("empty id"))
+		case entries[entry.ID]:
+			problem("entries", i, fmt.Errorf("%w %s", ErrDuplicateID, entry.ID))
+		case !accounts[entry.AccountID]:
+			problem("entries", i, fmt.Errorf("%w: %d", ErrUnknownAccount, entry.AccountID))
+		case entry.PaymentID != "" && !payments[entry.PaymentID]:
+			problem("entries", i, fmt.Errorf("%w: %s", ErrPaymentNotFound, entry.PaymentID))
+		case entry.Amount <= 0:
+			problem("entries", i, ErrAmountMustBePositive)
+		case !knownEntryKind(entry.Kind):
+			problem("entries", i, fmt.Errorf("%w %q", ErrUnknownEntryKind, entry.Kind))
+		}
+		entries[entry.ID] = true
+	}
+
+	attempts := make(map[string]bool, len(snap.attempts))
+	for i, attempt := range snap.attempts {
+		switch {
+		case attempt.ID == "":
+			problem("fraud_attempts", i, errors.New("empty id"))
+		case attempts[attempt.ID]:
+			problem("fraud_attempts", i, fmt.Errorf("%w %s", ErrDuplicateID, attempt.ID))
+		case !accounts[attempt.AccountID]:
+			problem("fraud_attempts", i, fmt.Errorf("%w: %d", ErrUnknownAccount, attempt.AccountID))
+		case attempt.PaymentID != "" && !payments[attempt.PaymentID]:
+			problem("fraud_attempts", i, fmt.Errorf("%w: %s", ErrPaymentNotFound, attempt.PaymentID))
+		case attempt.Decision != DecisionReview && attempt.Decision != DecisionDeny:
+			problem("fraud_attempts", i, fmt.Errorf("unknown decision %q", attempt.Decision))
+		}
+		attempts[attempt.ID] = true
+	}
+
+	accruals := make(map[int64]bool, len(snap.accruals))
+	for i, state := range snap.accruals {
+		switch {
+		case accruals[state.AccountID]:
+			problem("accruals", i, fmt.Errorf("%w %d", ErrDuplicateID, state.AccountID))
+		case !accounts[state.AccountID]:
+			problem("accruals", i, fmt.Errorf("%w: %d", ErrUnknownAccount, state.AccountID))
+		case state.Accrued.Sign() < 0:
+			problem("accruals", i, fmt.Errorf("negative accrued interest %s", state.Accrued))
+		}
+		accruals[state.AccountID] = true
+	}
+
+	limits := make(map[Limit]bool, len(snap.limits))
+	for i, limit := range snap.limits {
+		switch {
+		case limits[limit.key()]:
+			problem("limits", i, fmt.Errorf("%w: %v", ErrDuplicateID, limit))
+		case !accounts[limit.AccountID]:
+			problem("limits", i, fmt.Errorf("%w: %d", ErrUnknownAccount, limit.AccountID))
+		case limit.Period != LimitDaily && limit.Period != LimitMonthly:
+			problem("limits", i, fmt.Errorf("%w: unknown period %q", ErrInvalidLimit, limit.Period))
+		case limit.Amount <= 0:
+			problem("limits", i, ErrAmountMustBePositive)
+		}
+		limits[limit.key()] = true
+	}
+
+	budgets := make(map[Budget]bool, len(snap.budgets))
+	for i, budget := range snap.budgets {
+		switch {
+		case budgets[budget.key()]:
+			problem("budgets", i, fmt.Errorf("%w: budget %s of account %d", ErrDuplicateID, budget.Category, budget.AccountID))
+		case !accounts[budget.AccountID]:
+			problem("budgets", i, fmt.Errorf("%w: %d", ErrUnknownAccount, budget.AccountID))
+		case budget.Amount <= 0:
+			problem("budgets", i, ErrAmountMustBePositive)
+		}
+		budgets[budget.key()] = true
+	}
+}
+
+func knownEntryKind(kind types.EntryKind) bool {
+	switch kind {
+	case types.EntryDeposit, types.EntryCashback, types.EntryClawback, types.EntryFee, types.EntryFeeRefund, types.EntryInterest:
+		return true
+	}
+	return false
+}
+
+func knownStatus(status types.PaymentStatus) bool {
+	switch status {
+	case types.PaymentStatusOk, types.PaymentStatusFail, types.PaymentStatusInProgress:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestService_ValidateImport_success(t *testing.T) {
+	dir := exportTestDir(t)
+	defer os.RemoveAll(dir)
+
+	report, err := newTestService().ValidateImport(dir)
+	if err != nil {
+		t.Errorf("ValidateImport(): error = %v", err)
+		return
+	}
+	if !report.OK() || report.Accounts != 2 || report.Payments != 1 || report.Favorites != 1 {
+		t.Errorf("ValidateImport(): wrong report %v", report)
+		return
+	}
+}
+
+func TestService_ValidateImport_problems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"accounts.dump": "#wallet-dump accounts 2\n" +
+			"1;+992901000876;150000;\n" +
+			"2;+992901000877;abc;\n" +
+			"1;+992901000878;0;\n",
+		"payments.dump": "#wallet-dump payments 2\n" +
+			"a869fe66-7265-461d-a2a8-6e3dd4061f5d;1;200000;auto;DONE;\n" +
+			"0b8f2a1e-6c1d-4b7e-9d41-3f5a2c8e7b10;3;50000;food;FAIL;\n" +
+			"1c2d3e4f;1;50000;food;\n",
+		"favorites.dump": "#wallet-dump favorites 2\n" +
+			"daf9820c-0706-4480-932e-bc23c9875d52;1;My Favorite Payment;0;auto\n",
+		"limits.dump": "#wallet-dump limits 7\n" +
+			"1;fun;week;false;10000\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestService()
+	report, err := s.ValidateImport(dir)
+	if err != nil {
+		t.Errorf("ValidateImport(): error = %v", err)
+		return
+	}
+
+	want := []struct {
+		file string
+		line int
+		err  error
+	}{
+		{file: "accounts.dump", line: 3},
+		{file: "accounts.dump", line: 4, err: ErrDuplicateID},
+		{file: "payments.dump", line: 2, err: ErrUnknownStatus},
+		{file: "payments.dump", line: 3, err: ErrUnknownAccount},
+		{file: "payments.dump", line: 4},
+		{file: "favorites.dump", line: 2, err: ErrAmountMustBePositive},
+		{file: "limits.dump", line: 2, err: ErrInvalidLimit},
+	}
+	if len(report.Problems) != len(want) {
+		t.Errorf("ValidateImport(): want %v problems, got %v", len(want), report)
+		return
+	}
+	for i, problem := range report.Problems {
+		if problem.File != filepath.Join(dir, want[i].file) || problem.Line != want[i].line {
+			t.Errorf("ValidateImport(): want problem at %v:%v, got %v", want[i].file, want[i].line, problem)
+		}
+		if want[i].err != nil && !errors.Is(problem.Err, want[i].err) {
+			t.Errorf("ValidateImport(): want %v, got %v", want[i].err, problem)
+		}
+	}
+
+	if len(s.accounts) != 0 || len(s.payments) != 0 || len(s.favorites) != 0 {
+		t.Errorf("ValidateImport(): service changed")
+		return
+	}
+}
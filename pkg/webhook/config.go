@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+// Значения конфигурации по умолчанию
+const (
+	DefaultMaxAttempts    = 8
+	DefaultTimeout        = 10 * time.Second
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Hour
+)
+
+var ErrInvalidConfig = errors.New("invalid webhook config")
+
+// Duration - time.Duration, которая в JSON записывается строкой вида "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Endpoint - адрес партнёра, на который доставляются события платежей
+type Endpoint struct {
+	Name        string             `json:"name"`
+	URL         string             `json:"url"`
+	Secret      string             `json:"secret"`           // ключ подписи HMAC-SHA256
+	Events      []wallet.EventKind `json:"events,omitempty"` // пусто - все события платежей
+	MaxAttempts int                `json:"maxAttempts,omitempty"`
+	Timeout     Duration           `json:"timeout,omitempty"` // таймаут одной попытки
+}
+
+// wants сообщает, подписан ли адрес на события kind
+func (e Endpoint) wants(kind wallet.EventKind) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, event := range e.Events {
+		if event == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Endpoint) maxAttempts() int {
+	if e.MaxAttempts > 0 {
+		return e.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (e Endpoint) timeout() time.Duration {
+	if e.Timeout > 0 {
+		return time.Duration(e.Timeout)
+	}
+	return DefaultTimeout
+}
+
+// Config - настройки диспетчера вебхуков. Задержка перед повтором удваивается
+// после каждой неудачной попытки, начиная с InitialBackoff, но не больше MaxBackoff
+type Config struct {
+	Endpoints      []Endpoint `json:"endpoints"`
+	InitialBackoff Duration   `json:"initialBackoff,omitempty"`
+	MaxBackoff     Duration   `json:"maxBackoff,omitempty"`
+}
+
+// LoadConfig читает конфигурацию из JSON-файла
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c Config) validate() error {
+	names := make(map[string]bool, len(c.Endpoints))
+	for _, endpoint := range c.Endpoints {
+		if endpoint.Name == "" {
+			return fmt.Errorf("%w: endpoint %q has no name", ErrInvalidConfig, endpoint.URL)
+		}
+		if names[endpoint.Name] {
+			return fmt.Errorf("%w: duplicate endpoint %q", ErrInvalidConfig, endpoint.Name)
+		}
+		names[endpoint.Name] = true
+
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: endpoint %q: invalid url %q", ErrInvalidConfig, endpoint.Name, endpoint.URL)
+		}
+		if endpoint.Secret == "" {
+			return fmt.Errorf("%w: endpoint %q has no secret", ErrInvalidConfig, endpoint.Name)
+		}
+	}
+	return nil
+}
+
+// backoff возвращает задержку перед попыткой, следующей за attempts неудачными
+func (c Config) backoff(attempts int) time.Duration {
+	delay, limit := time.Duration(c.InitialBackoff), time.Duration(c.MaxBackoff)
+	if delay <= 0 {
+		delay = DefaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+// Delivery - доставка одного события на один адрес, хранимая в outbox до успеха
+type Delivery struct {
+	ID          string           `json:"id"`
+	Endpoint    string           `json:"endpoint"`
+	Event       wallet.EventKind `json:"event"`
+	Payload     json.RawMessage  `json:"payload"`
+	Created     time.Time        `json:"created"`
+	Attempts    int              `json:"attempts"`
+	NextAttempt time.Time        `json:"nextAttempt"`
+	LastError   string           `json:"lastError,omitempty"`
+}
+
+// Outbox хранит недоставленные события файлами <id>.json в каталоге, поэтому
+// они переживают перезапуск. Доставки, исчерпавшие попытки, переносятся в dead/
+type Outbox struct {
+	dir string
+}
+
+// OpenOutbox открывает outbox в каталоге dir, создавая его при необходимости
+func OpenOutbox(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "dead"), 0755); err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// Pending возвращает недоставленные события в порядке создания
+func (o *Outbox) Pending() ([]Delivery, error) {
+	return readDeliveries(o.dir)
+}
+
+// Dead возвращает доставки, исчерпавшие попытки
+func (o *Outbox) Dead() ([]Delivery, error) {
+	return readDeliveries(filepath.Join(o.dir, "dead"))
+}
+
+// save атомарно записывает доставку: сначала во временный файл, затем переименованием
+func (o *Outbox) save(delivery Delivery) error {
+	return writeDelivery(o.dir, delivery)
+}
+
+func (o *Outbox) remove(id string) error {
+	return os.Remove(filepath.Join(o.dir, id+".json"))
+}
+
+// bury переносит доставку в dead/
+func (o *Outbox) bury(delivery Delivery) error {
+	if err := writeDelivery(filepath.Join(o.dir, "dead"), delivery); err != nil {
+		return err
+	}
+	return o.remove(delivery.ID)
+}
+
+func writeDelivery(dir string, delivery Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(dir, delivery.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(dir, delivery.ID+".json"))
+}
+
+func readDeliveries(dir string) ([]Delivery, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(data, &delivery); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, file.Name()), err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].Created.Before(deliveries[j].Created)
+	})
+	return deliveries, nil
+}
@@ -0,0 +1,322 @@
+// Package webhook доставляет партнёрам события платежей wallet.Service
+// HTTP-запросами с подписью HMAC и повторами через outbox
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+	"github.com/google/uuid"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderDelivery  = "X-Wallet-Delivery"
+	HeaderEvent     = "X-Wallet-Event"
+	HeaderTimestamp = "X-Wallet-Timestamp"
+	HeaderSignature = "X-Wallet-Signature"
+)
+
+// Payload - тело запроса вебхука. ID одинаков для всех попыток и адресов,
+// поэтому получатель может отбрасывать повторы
+type Payload struct {
+	ID      string           `json:"id"`
+	Event   wallet.EventKind `json:"event"`
+	Time    time.Time        `json:"time"`
+	Payment types.Payment    `json:"payment"`
+}
+
+// Sign возвращает подпись тела body, отправленного в момент timestamp (unix-секунды):
+// "sha256=" и HMAC-SHA256 ключом secret от строки "<timestamp>.<body>" в hex
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись запроса вебхука с заголовками header и телом body
+func Verify(secret string, header http.Header, body []byte) bool {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(header.Get(HeaderSignature)))
+}
+
+// Dispatcher принимает события сервиса в outbox и доставляет их на адреса из
+// конфигурации. Методы безопасны для вызова из разных горутин
+type Dispatcher struct {
+	config    Config
+	endpoints map[string]Endpoint
+	outbox    *Outbox
+	client    *http.Client
+	clock     func() time.Time
+
+	mu       sync.Mutex
+	pending  []Delivery
+	inFlight map[string]bool
+	wake     chan struct{}
+}
+
+// New создаёт диспетчер и загружает из outbox события, не доставленные до перезапуска
+func New(config Config, outbox *Outbox) (*Dispatcher, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	pending, err := outbox.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		config:    config,
+		endpoints: make(map[string]Endpoint, len(config.Endpoints)),
+		outbox:    outbox,
+		client:    &http.Client{},
+		clock:     time.Now,
+		pending:   pending,
+		inFlight:  make(map[string]bool),
+		wake:      make(chan struct{}, 1),
+	}
+	for _, endpoint := range config.Endpoints {
+		d.endpoints[endpoint.Name] = endpoint
+	}
+	return d, nil
+}
+
+// SetClient задаёт HTTP-клиент для доставки
+func (d *Dispatcher) SetClient(client *http.Client) {
+	d.client = client
+}
+
+// SetClock подменяет источник текущего времени, например в тестах
+func (d *Dispatcher) SetClock(clock func() time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = clock
+}
+
+// Subscribe подписывает диспетчер на события платежей svc
+func (d *Dispatcher) Subscribe(svc *wallet.Service) (unsubscribe func()) {
+	return svc.Subscribe(d.Handle, wallet.EventPaymentCreated, wallet.EventPaymentConfirmed, wallet.EventPaymentRejected)
+}
+
+// Handle - wallet.EventHandler, который сохраняет событие платежа в outbox для
+// каждого подписанного адреса. Сама доставка выполняется в Run
+func (d *Dispatcher) Handle(ctx context.Context, event wallet.Event) {
+	var payment types.Payment
+	switch e := event.(type) {
+	case wallet.PaymentCreated:
+		payment = e.Payment
+	case wallet.PaymentConfirmed:
+		payment = e.Payment
+	case wallet.PaymentRejected:
+		payment = e.Payment
+	default:
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock().UTC()
+	payload, err := json.Marshal(Payload{ID: uuid.New().String(), Event: event.Kind(), Time: now, Payment: payment})
+	if err != nil {
+		log.Printf("webhook %s: %v", event.Kind(), err)
+		return
+	}
+
+	for _, endpoint := range d.config.Endpoints {
+		if !endpoint.wants(event.Kind()) {
+			continue
+		}
+		delivery := Delivery{
+			ID:          uuid.New().String(),
+			Endpoint:    endpoint.Name,
+			Event:       event.Kind(),
+			Payload:     payload,
+			Created:     now,
+			NextAttempt: now,
+		}
+		if err := d.outbox.save(delivery); err != nil {
+			log.Printf("webhook %s to %s: %v", event.Kind(), endpoint.Name, err)
+			continue
+		}
+		d.pending = append(d.pending, delivery)
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending возвращает ещё не доставленные события
+func (d *Dispatcher) Pending() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Delivery(nil), d.pending...)
+}
+
+// Run доставляет события, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		d.DeliverDue(ctx)
+
+		var wait time.Duration
+		scheduled := false
+		d.mu.Lock()
+		now := d.clock()
+		for _, delivery := range d.pending {
+			delay := delivery.NextAttempt.Sub(now)
+			if delay < 0 {
+				delay = 0
+			}
+			if !scheduled || delay < wait {
+				wait, scheduled = delay, true
+			}
+		}
+		d.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var due <-chan time.Time
+		if scheduled {
+			timer.Reset(wait)
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.wake:
+		case <-due:
+		}
+	}
+}
+
+// DeliverDue делает по одной попытке доставки событий, время повтора которых наступило
+func (d *Dispatcher) DeliverDue(ctx context.Context) {
+	d.mu.Lock()
+	now := d.clock()
+	var due []Delivery
+	for _, delivery := range d.pending {
+		if !delivery.NextAttempt.After(now) && !d.inFlight[delivery.ID] {
+			d.inFlight[delivery.ID] = true
+			due = append(due, delivery)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			d.mu.Lock()
+			delete(d.inFlight, delivery.ID)
+			d.mu.Unlock()
+			continue
+		}
+		err := d.send(ctx, delivery)
+		d.finish(delivery, err)
+	}
+}
+
+// send выполняет одну попытку доставки. Успехом считается ответ 2xx
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) error {
+	endpoint, ok := d.endpoints[delivery.Endpoint]
+	if !ok {
+		return fmt.Errorf("unknown endpoint %q", delivery.Endpoint)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, endpoint.timeout())
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	timestamp := d.clock().Unix()
+	d.mu.Unlock()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// finish сохраняет результат попытки: удаляет доставленное событие, планирует
+// повтор или переносит в dead/ событие, исчерпавшее попытки
+func (d *Dispatcher) finish(delivery Delivery, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inFlight, delivery.ID)
+
+	index := -1
+	for i := range d.pending {
+		if d.pending[i].ID == delivery.ID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return
+	}
+
+	var storeErr error
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		storeErr = d.outbox.remove(delivery.ID)
+	case delivery.Attempts >= d.endpoints[delivery.Endpoint].maxAttempts():
+		delivery.LastError = err.Error()
+		log.Printf("webhook %s to %s failed after %d attempts: %v", delivery.ID, delivery.Endpoint, delivery.Attempts, err)
+		storeErr = d.outbox.bury(delivery)
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttempt = d.clock().UTC().Add(d.config.backoff(delivery.Attempts))
+		d.pending[index] = delivery
+		//повтор остаётся в памяти, даже если не удалось обновить outbox
+		if err := d.outbox.save(delivery); err != nil {
+			log.Printf("webhook %s outbox: %v", delivery.ID, err)
+		}
+		return
+	}
+	if storeErr != nil {
+		log.Printf("webhook %s outbox: %v", delivery.ID, storeErr)
+	}
+	d.pending = append(d.pending[:index], d.pending[index+1:]...)
+}
@@ -0,0 +1,307 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RAZ-os/wallet/pkg/types"
+	"github.com/RAZ-os/wallet/pkg/wallet"
+)
+
+const testSecret = "partner-secret"
+
+// receiver - локальный получатель вебхуков, отвечающий статусами из statuses
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newReceiver(statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{statuses: statuses, received: make(chan struct{}, 16)}
+	return r, httptest.NewServer(r)
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	status := http.StatusOK
+	if len(r.requests) < len(r.statuses) {
+		status = r.statuses[len(r.requests)]
+	}
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+	r.received <- struct{}{}
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// testClock - часы, которые тест переводит вручную
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestDispatcher(t *testing.T, dir string, endpoints ...Endpoint) (*Dispatcher, *testClock) {
+	t.Helper()
+	outbox, err := OpenOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(Config{Endpoints: endpoints, InitialBackoff: Duration(time.Second)}, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{now: time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)}
+	d.SetClock(clock.Now)
+	return d, clock
+}
+
+func payOnce(t *testing.T, d *Dispatcher) *types.Payment {
+	t.Helper()
+	svc := &wallet.Service{}
+	d.Subscribe(svc)
+	account, err := svc.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payment
+}
+
+func TestDispatcher_signedDelivery(t *testing.T) {
+	r, srv := newReceiver()
+	defer srv.Close()
+	d, _ := newTestDispatcher(t, t.TempDir(), Endpoint{Name: "partner", URL: srv.URL, Secret: testSecret})
+
+	payment := payOnce(t, d)
+	d.DeliverDue(context.Background())
+
+	if r.count() != 1 {
+		t.Fatalf("DeliverDue(): want 1 request, got %v", r.count())
+	}
+	req, body := r.requests[0], r.bodies[0]
+	if !Verify(testSecret, req.Header, body) {
+		t.Errorf("Verify(): signature %q does not match body %s", req.Header.Get(HeaderSignature), body)
+	}
+	if Verify("other-secret", req.Header, body) {
+		t.Errorf("Verify(): signature must not match other secret")
+	}
+	if req.Header.Get(HeaderEvent) != string(wallet.EventPaymentCreated) {
+		t.Errorf("request: want event %v, got %v", wallet.EventPaymentCreated, req.Header.Get(HeaderEvent))
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID == "" || payload.Payment.ID != payment.ID || payload.Payment.Status != types.PaymentStatusInProgress {
+		t.Errorf("payload: want payment %v, got %+v", payment.ID, payload)
+	}
+	if len(d.Pending()) != 0 {
+		t.Errorf("Pending(): want nothing after delivery, got %v", d.Pending())
+	}
+}
+
+func TestDispatcher_retryBackoff(t *testing.T) {
+	r, srv := newReceiver(http.StatusInternalServerError, http.StatusBadGateway)
+	defer srv.Close()
+	dir := t.TempDir()
+	d, clock := newTestDispatcher(t, dir, Endpoint{Name: "partner", URL: srv.URL, Secret: testSecret})
+	start := clock.now
+
+	payOnce(t, d)
+	ctx := context.Background()
+	wantNext := []time.Duration{time.Second, 3 * time.Second}
+	for attempt, next := range wantNext {
+		d.DeliverDue(ctx)
+		pending := d.Pending()
+		if len(pending) != 1 || pending[0].Attempts != attempt+1 || !pending[0].NextAttempt.Equal(start.Add(next)) {
+			t.Fatalf("attempt %d: want retry at %v, got %+v", attempt+1, start.Add(next), pending)
+		}
+
+		//до времени повтора попыток нет
+		d.DeliverDue(ctx)
+		if r.count() != attempt+1 {
+			t.Fatalf("attempt %d: want %d requests before backoff, got %v", attempt+1, attempt+1, r.count())
+		}
+		clock.now = pending[0].NextAttempt
+	}
+
+	d.DeliverDue(ctx)
+	if r.count() != 3 || len(d.Pending()) != 0 {
+		t.Errorf("DeliverDue(): want delivery on 3rd attempt, got %v requests, pending %v", r.count(), d.Pending())
+	}
+	//повторы подписаны и несут то же событие
+	var first, last Payload
+	json.Unmarshal(r.bodies[0], &first)
+	json.Unmarshal(r.bodies[2], &last)
+	if first.ID != last.ID || !Verify(testSecret, r.requests[2].Header, r.bodies[2]) {
+		t.Errorf("retry: want same signed event %v, got %v", first.ID, last.ID)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("outbox: want empty after delivery, got %v", files)
+	}
+}
+
+func TestDispatcher_outboxSurvivesRestart(t *testing.T) {
+	r, srv := newReceiver(http.StatusServiceUnavailable)
+	defer srv.Close()
+	dir := t.TempDir()
+	endpoint := Endpoint{Name: "partner", URL: srv.URL, Secret: testSecret}
+
+	d, _ := newTestDispatcher(t, dir, endpoint)
+	payOnce(t, d)
+	d.DeliverDue(context.Background())
+
+	restarted, clock := newTestDispatcher(t, dir, endpoint)
+	pending := restarted.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("New(): want 1 failed delivery from outbox, got %+v", pending)
+	}
+	clock.now = pending[0].NextAttempt
+	restarted.DeliverDue(context.Background())
+	if r.count() != 2 || len(restarted.Pending()) != 0 {
+		t.Errorf("DeliverDue(): want delivery after restart, got %v requests, pending %v", r.count(), restarted.Pending())
+	}
+}
+
+func TestDispatcher_deadAfterMaxAttempts(t *testing.T) {
+	_, srv := newReceiver(http.StatusInternalServerError, http.StatusInternalServerError)
+	defer srv.Close()
+	dir := t.TempDir()
+	d, clock := newTestDispatcher(t, dir, Endpoint{Name: "partner", URL: srv.URL, Secret: testSecret, MaxAttempts: 2})
+
+	payOnce(t, d)
+	d.DeliverDue(context.Background())
+	clock.now = clock.now.Add(time.Minute)
+	d.DeliverDue(context.Background())
+
+	if len(d.Pending()) != 0 {
+		t.Errorf("Pending(): want nothing after max attempts, got %v", d.Pending())
+	}
+	outbox, _ := OpenOutbox(dir)
+	dead, err := outbox.Dead()
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 2 {
+		t.Errorf("Dead(): want 1 delivery after 2 attempts, got %+v, %v", dead, err)
+	}
+}
+
+func TestDispatcher_endpointEvents(t *testing.T) {
+	created, createdSrv := newReceiver()
+	defer createdSrv.Close()
+	rejected, rejectedSrv := newReceiver()
+	defer rejectedSrv.Close()
+	d, _ := newTestDispatcher(t, t.TempDir(),
+		Endpoint{Name: "all", URL: createdSrv.URL, Secret: testSecret},
+		Endpoint{Name: "rejects", URL: rejectedSrv.URL, Secret: "another", Events: []wallet.EventKind{wallet.EventPaymentRejected}},
+	)
+
+	svc := &wallet.Service{}
+	d.Subscribe(svc)
+	account, err := svc.RegisterAccount("+992901000876")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, err := svc.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Reject(payment.ID); err != nil {
+		t.Fatal(err)
+	}
+	d.DeliverDue(context.Background())
+
+	if created.count() != 2 || rejected.count() != 1 {
+		t.Fatalf("DeliverDue(): want 2 and 1 requests, got %v and %v", created.count(), rejected.count())
+	}
+	var payload Payload
+	json.Unmarshal(rejected.bodies[0], &payload)
+	if payload.Event != wallet.EventPaymentRejected || payload.Payment.Status != types.PaymentStatusFail {
+		t.Errorf("payload: want rejected payment, got %+v", payload)
+	}
+	if !Verify("another", rejected.requests[0].Header, rejected.bodies[0]) {
+		t.Errorf("Verify(): want signature with endpoint secret")
+	}
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	r, srv := newReceiver()
+	defer srv.Close()
+	outbox, err := OpenOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(Config{Endpoints: []Endpoint{{Name: "partner", URL: srv.URL, Secret: testSecret}}}, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	payOnce(t, d)
+	select {
+	case <-r.received:
+	case <-time.After(5 * time.Second):
+		t.Error("Run(): event was not delivered")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run(): want context.Canceled, got %v", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		`{"endpoints":[{"name":"a","url":"https://partner.example/hook","secret":"s","timeout":"5s"}],"maxBackoff":"10m"}`: "",
+		`{"endpoints":[{"name":"a","url":"ftp://partner.example","secret":"s"}]}`:                                           "invalid url",
+		`{"endpoints":[{"name":"a","url":"http://a","secret":"s"},{"name":"a","url":"http://b","secret":"s"}]}`:             "duplicate",
+		`{"endpoints":[{"name":"a","url":"http://a"}]}`:                                                                     "no secret",
+	}
+
+	for content, problem := range tests {
+		path := filepath.Join(dir, "webhooks.json")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadConfig(path)
+		if problem == "" {
+			if err != nil || time.Duration(config.Endpoints[0].Timeout) != 5*time.Second || config.backoff(20) != 10*time.Minute {
+				t.Errorf("LoadConfig(%s): got %+v, %v", content, config, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("LoadConfig(%s): want %s error, got %v", content, problem, err)
+		}
+	}
+}